@@ -0,0 +1,3 @@
+module railway_simulator
+
+go 1.21
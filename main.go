@@ -9,6 +9,7 @@ package main
 import (
     "fmt"
     "time"
+    "container/heap"
     "math"    
     "os"
     "bufio"
@@ -16,28 +17,120 @@ import (
     "strings"
     "strconv"
     "math/rand"
+    "flag"
+    "path/filepath"
+    "encoding/json"
+    "io/ioutil"
+    "bytes"
+    "context"
+    "os/signal"
+    "syscall"
+    "io"
+    "sort"
     //"sync"
 )
 
 
 /*  Constants set  */
 
-//time multiplier
+//defaults of command line flags, see default_config
+
+//time multiplier, only paces the output, simulated time is virtual
 //3600 -> 1hour = 1sec
 //60 -> 1hour = 1min
 //1 -> 1hour = 1hour (real time speed)
+//0 -> no waiting at all, simulate as fast as possible
 const TIME_RATE = 1000
 
+//simulated hours to run, 0 -> run until user presses enter
+const SIMULATION_TIME_H = 0
+
 //silent mode (no terminal output)
 const SILENT_MODE = false
 
-//paths of input data files
-const SYSTEM_PATH = "input_data/system.txt"
-const RAILWAYS_PATH = "input_data/railways.txt"
-const TRAINS_PATH = "input_data/trains.txt"
-const STATIONS_PATH = "input_data/stations.txt"
-const SWITCHES_PATH = "input_data/switches.txt"
-const VERTEX_SET_PATH = "input_data/vertex_set.txt"
+//directory and names of input data files
+const DATA_DIR = "input_data"
+const SYSTEM_FILE = "system.txt"
+const RAILWAYS_FILE = "railways.txt"
+const TRAINS_FILE = "trains.txt"
+const STATIONS_FILE = "stations.txt"
+const SWITCHES_FILE = "switches.txt"
+const VERTEX_SET_FILE = "vertex_set.txt"
+const DEMAND_FILE = "demand.txt"     //optional
+const PROFILES_FILE = "profiles.txt" //optional, hourly factors of demand
+const TIMETABLE_FILE = "timetable.txt" //optional
+
+//profile of demand rows without one
+const PROFILE_FLAT = "flat"
+
+//services of trains
+const SERVICE_CIRCULAR = "circular" //goes around, from last vertex of path back to first
+const SERVICE_SHUTTLE = "shuttle"   //reverses at both ends of path
+const SERVICE_ONE_SHOT = "one-shot" //runs path once and ends in depot of last station
+
+//kinds of scheduled times
+const SCHEDULE_ARRIVAL = "arrival"
+const SCHEDULE_DEPARTURE = "departure"
+
+//root causes of delay
+const CAUSE_RAILWAY = "railway"   //waiting for railway used by a train which is not late
+const CAUSE_PLATFORM = "platform" //every platform of station in use or closed by console
+const CAUSE_SWITCH = "switch"     //rail switch rotating for a train which is not late
+const CAUSE_CRASH = "crash"       //broken train, railway, switch or platform, or repair vehicle in the way
+const CAUSE_KNOCK_ON = "knock-on" //waiting for a train which is late itself
+const CAUSE_HELD = "held"         //held by console
+const CAUSE_RUNNING = "running"   //not explained by waiting, timetable is tighter than the run
+
+//directory and name of simulator-wide log, every actor has its own log there too
+const LOGS_DIR = "logs"
+const SIMULATOR_LOG = "simulator"
+
+//JSON lines file with every event
+const EVENTS_LOG = "events.jsonl"
+
+//event types
+const EVENT_MESSAGE = "message"
+const EVENT_SIMULATOR_STARTED = "simulator_started"
+const EVENT_SIMULATOR_ENDED = "simulator_ended"
+const EVENT_TRAIN_STARTED = "train_started"
+const EVENT_TRAIN_ENTERED_EDGE = "train_entered_edge"
+const EVENT_TRAIN_AT_SWITCH = "train_at_switch"
+const EVENT_TRAIN_ARRIVED_STATION = "train_arrived_station"
+const EVENT_TRAIN_READY = "train_ready_to_leave"
+const EVENT_TRAIN_LEFT_STATION = "train_left_station"
+const EVENT_TRAIN_STOPPED = "train_stopped"
+const EVENT_TRAIN_BROKE_DOWN = "train_broke_down"
+const EVENT_TRAIN_RESUMED = "train_resumed"
+const EVENT_TRAIN_HELD = "train_held"
+const EVENT_TRAIN_RELEASED = "train_released"
+const EVENT_TRAIN_REVERSED = "train_reversed"
+const EVENT_TRAIN_FINISHED = "train_finished"
+const EVENT_PLATFORM_CLOSED = "platform_closed"
+const EVENT_PLATFORM_OPENED = "platform_opened"
+const EVENT_CONSOLE_COMMAND = "console_command"
+const EVENT_PASSENGERS_ALIGHTED = "passengers_alighted"
+const EVENT_PASSENGERS_BOARDED = "passengers_boarded"
+const EVENT_SWITCH_ROTATED = "switch_rotated"
+const EVENT_CRASH = "crash"
+const EVENT_REPAIR_DISPATCHED = "repair_dispatched"
+const EVENT_REPAIR_COMPLETED = "repair_completed"
+const EVENT_REPAIR_ASSIGNED = "repair_assigned"
+const EVENT_REPAIR_QUEUED = "repair_queued"
+const EVENT_NO_ROUTE = "no_route"
+const EVENT_DEPOT_CUT_OFF = "depot_cut_off"
+const EVENT_DEPOT_RECONNECTED = "depot_reconnected"
+const EVENT_VEHICLE_ENTERED_EDGE = "repair_vehicle_entered_edge"
+const EVENT_VEHICLE_AT_SWITCH = "repair_vehicle_at_switch"
+const EVENT_VEHICLE_AT_STATION = "repair_vehicle_at_station"
+const EVENT_VEHICLE_AT_TRAIN = "repair_vehicle_at_train"
+const EVENT_VEHICLE_RETURNED = "repair_vehicle_returned"
+const EVENT_VEHICLE_STOPPED = "repair_vehicle_stopped"
+
+//crashed and repaired assets in events
+const ASSET_RAILWAY = "railway"
+const ASSET_TRAIN = "train"
+const ASSET_RAIL_SWITCH = "rail_switch"
+const ASSET_PLATFORM = "platform"
 
 //vertex type
 const RAIL_SWITCH = 1
@@ -47,48 +140,144 @@ const STATION = 2
 const REPAIR_VEHICLE_SPEED = 150.0
 const REPAIR_VEHICLE_NAME = "Repair Vehicle"
 const STATION_VERTEX = 12
+
+//order no vehicle could reach goes back to dispatcher after this, doubled on every try up to a day
+const UNREACHABLE_RETRY_H = 1
+const UNREACHABLE_RETRY_MAX_H = 24
 const RAIL_SWITCH_REPAIR_TIME_H = 2
 const RAILWAY_REPAIR_TIME_H = 2 
 const TRAIN_REPAIR_TIME_H = 2
+const PLATFORM_REPAIR_TIME_H = 2
+
+//repair time distributions, see parse_distribution
+const DIST_FIXED = "fixed"
+const DIST_UNIFORM = "uniform"
+const DIST_EXPONENTIAL = "exp"
+const DIST_LOGNORMAL = "lognormal"
+const DIST_HISTOGRAM = "hist"
 
 //consts used by repair vehicle
 const RAIL_SWITCH_REPAIR = 1
 const RAILWAY_REPAIR = 2
 const TRAIN_REPAIR = 3
+const PLATFORM_REPAIR = 4
+
+//how dispatcher chooses repair vehicle for an incident
+const DISPATCH_NEAREST = "nearest"         //nearest idle vehicle, others wait in queue
+const DISPATCH_ETA = "eta"                 //vehicle which can be there first, even if busy now
+const DISPATCH_PRIORITY = "priority"       //like nearest, but queue is served by fault type
+const DISPATCH_ROUND_ROBIN = "round-robin" //vehicles take turns
 
 //crash rate
 //0.0 - 1.0
 const CRASH_RATE = 0.2
 
+//simulated minutes between two crash rolls
+const CRASH_INTERVAL_MIN = 6
 
-/* Global variables */
+//random crashes wait while this many incidents are open, 0 = no limit
+const MAX_OPEN_INCIDENTS = 1
+
+//usage units of failure models
+const USAGE_KM = "km"
+const USAGE_ROTATIONS = "rotations"
+
+//exit codes of run command, show how simulation ended
+const EXIT_TIME_LIMIT = 0
+const EXIT_INPUT_ERROR = 1
+const EXIT_LAPS_DONE = 3
+const EXIT_CRASH_LIMIT = 4
+const EXIT_DEADLOCK = 5
+const EXIT_INTERRUPTED = 130
 
-//true if railway system is broken
-var crash_active = false
+
+/* Global variables */
 
 //start date and time
 var start_time = time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
-var init_start_time = time.Now()
+
+//settings of current run
+var settings = default_config()
+
+//virtual clock driving all actors
+var scheduler = new_event_scheduler(TIME_RATE)
+
+//counters of current run
+var stats = new_run_summary()
+
+//simulator-wide event log, actor logs write to it too
+var sim_log = new_logger(terminal_sink{})
 
 
 /* Structure set */
 
+//simulator settings, filled from command line flags
+type config struct {
+    data_dir                string
+    time_rate               float64
+    silent_mode             bool
+    crash_rate              float64
+    duration                time.Duration //0 = no time limit
+    laps                    int           //stop when every train has done laps, 0 = no limit
+    max_crashes             int           //stop after crashes, 0 = no limit
+    max_open_incidents      int           //random crashes wait while this many are open, 0 = no limit
+    seed                    int64         //0 = pick one from current time
+    repair_vertex           int
+    repair_speed            float64
+    fleet_spec              string        //-fleet flag, "vertex:vehicles,..."
+    fleet                   []fleet_depot //filled by check_depot
+    dispatch                string        //DISPATCH_* policy
+    rail_switch_repair_time distribution
+    railway_repair_time     distribution
+    train_repair_time       distribution
+    platform_repair_time    distribution
+    railway_failure         failure_model //empty models and no asset models = crash_rate is used
+    rail_switch_failure     failure_model
+    train_failure           failure_model
+    incidents_file          string //incident script, replaces incidents of scenario file
+    console                 bool   //control console on stdin
+    on_time                 thresholds //lateness still counted as on time in punctuality report
+    passenger_rate          float64 //passengers per hour appearing at every station, 0 = none
+    demand                  *demand //from -passengers or input data, nil = no passengers
+}
+
 //edge
 type railway struct {
     max_speed   float64 //in kmh
     length      float64 //km
-    is_free     chan bool
+    is_free     *sim_semaphore
+    incident    int //open incident, 0 = not broken
+    repair      *distribution //own repair time, nil = railway_repair_time of settings
+    health      asset_health  //km travelled by trains
 }
 
 type train struct {
     name            string
-    people          int
+    line            string //service line of punctuality report, name of train if not given
+    service         string //SERVICE_*
+    turnaround      float64 //minutes at both ends of shuttle, 0 = wait time of station
+    people          int //passengers on board
+    passengers      []passenger
     capacity        int 
     speed           float64 //max speed in kmh
     path            []int
     current_strech  []int
-    broken          bool
-    repaired        chan bool
+    position        float64 //km from current_strech[0], updated when train stops or starts moving
+    moving_since    time.Duration //on the move since, 0 with moving false
+    moving          bool
+    kmh             float64 //speed on current railway
+    held            bool //by console, train waits at next station until released
+    released        *sim_channel
+    broken          bool //set by crash, train halts where it is until repaired
+    incident        int  //incident of last breakdown
+    repaired        *sim_channel
+    actor           *actor //interrupted when train breaks down on railway
+    repair          *distribution //own repair time, nil = train_repair_time of settings
+    health          asset_health  //km travelled
+    timetable       []scheduled_stop //in order of travel, empty = train runs as soon as it can
+    finished        bool //one-shot train is in depot
+    late            time.Duration //behind timetable at last scheduled stop, negative = early
+    ledger          delay_ledger  //causes of delay
 }
 
 type vertex struct {
@@ -99,19 +288,27 @@ type vertex struct {
  //type of vertex
 type station struct {
     name            string
-    free_platforms  chan bool
-    free_depots     chan bool
+    free_platforms  *sim_semaphore
+    free_depots     *sim_semaphore
     wait_time       float64 //in minutes
     vertex_index    int
+    platforms       int
+    closed_platforms int //out of service until repaired or opened by console
+    waiting         []passenger //queue on platform, first come first served
+    console_closed  []*actor //console actors keeping platforms closed, console can open them again
 }
 
  //type of vertex
 type rail_switch struct {
+    name            string    //optional, scenario files name every vertex
     wait_time       float64   //minutes to switch
-    is_free         chan bool //true inside if no1 train using atm
-    rotating        chan bool //
-    rotate_done     chan bool //
+    is_free         *sim_semaphore //free if no1 train using atm
+    rotating        *sim_channel   //
+    rotate_done     *sim_channel   //
     vertex_index    int
+    incident        int //open incident, 0 = not broken
+    repair          *distribution //own repair time, nil = rail_switch_repair_time of settings
+    health          asset_health  //rotations
 }
 
 type repair_vehicle struct {
@@ -119,633 +316,5409 @@ type repair_vehicle struct {
     speed               float64 //max speed in kmh
     path                []int
     STATION_VERTEX      int
-    rail_switch_crash   chan int
-    railway_crash       chan int
-    train_crash         chan int
+    vertex              int //where vehicle waits for orders, depot unless it found no way back
+    orders              *sim_channel //repair_order values
+    idle                bool //at depot with no order
+    free_at             time.Duration //estimated return after assigned orders, used by eta policy
+    actor               *actor //interrupted on new incident while waiting for railway or switch
 }
 
+//repair vehicles stationed at vertex
+type fleet_depot struct {
+    vertex      int
+    vehicles    int
+}
 
-/* Simulator time functions */
-
-func get_current_simulator_time() time.Time {
-    diff := time.Now().Sub(init_start_time)*TIME_RATE
-    time_to_return := start_time
-    return time_to_return.Add(diff)
+//order sent by crash to repair vehicle
+type repair_order struct {
+    incident    int
+    repair_type int //RAIL_SWITCH_REPAIR, RAILWAY_REPAIR or TRAIN_REPAIR
+    index       int //train index or rail switch vertex
+    vertex1     int //crashed railway
+    vertex2     int
+    repair_time time.Duration //drawn by crash
+    restore     func()        //gives token of failed railway, switch or platform back after repair
+    retries     int           //times vehicle could not reach the site
 }
 
-func get_current_simulator_time_as_string() string {
-    return get_current_simulator_time().Format("2006-01-02 15:04")
+
+/* Discrete-event engine */
+
+//simulated process, every train, switch etc. runs as one
+type actor struct {
+    name        string
+    wake        chan bool
+    done        bool //actor function has returned
+    waiting     bool //blocked on semaphore or channel, not on time
+    background  bool //can not unblock others, not counted in deadlock detection
+    wakeup      int  //seq of the only valid wake up, older ones were cancelled
+    interruptible bool //in sleep_interruptible or acquire_interruptible, interrupt can wake it early
+    blocked_on  *sim_semaphore //waiting for token of it
 }
 
-//return travel time in real-world miliseconds
-func get_travel_time(km float64, train_kmh float64, rail_max_speed float64) float64{
-    speed_in_kmh := math.Min(train_kmh, rail_max_speed)
-    travel_time_in_h := km/speed_in_kmh
-    return travel_time_in_h*3600000
+//scheduled wake up of an actor
+type sim_event struct {
+    at      time.Duration //simulated time since start_time
+    seq     int           //insertion order, keeps events at the same time deterministic
+    actor   *actor
 }
 
-/* Input data reading function */
+//events ordered by time, implements heap.Interface
+type event_queue []sim_event
 
-//Get all data from files
-func read_data(
-    railways_path string,
-    system_path string,
-    trains_path string,
-    stations_path string,
-    vertex_set_path string,
-    switches_path string) ([][]railway, []station, []train, []vertex, []rail_switch) {
-    
-    var railways []railway
-    var system [][]railway
-    var stations []station
-    var trains []train
-    var rail_switches []rail_switch
-    var vertex_set []vertex
+func (q event_queue) Len() int { return len(q) }
 
-    //Get railways
-    file, err := os.Open(railways_path)
-    if err != nil {
-        log.Fatal(err)
-    }
-    defer file.Close()
-    scanner := bufio.NewScanner(file)
-    
-    i,j := 0,0
-    for scanner.Scan() {
-        line := scanner.Text()
-        switch i{
-        case 0:
-            n, _ := strconv.Atoi(line)
-            railways = make([]railway, n)
-        case 1:
-        default:
-            tokens := strings.Split(line, " ")
-            max_speed,_ := strconv.ParseFloat(tokens[0],64)
-            length,_ := strconv.ParseFloat(tokens[1],64)
-            is_free := make(chan bool, 1)
-            is_free <- true
-            railways[j] = railway{max_speed: max_speed, length: length, is_free: is_free}
-            j++
-        }
-        i++
+func (q event_queue) Less(i, j int) bool {
+    if q[i].at != q[j].at {
+        return q[i].at < q[j].at
     }
+    return q[i].seq < q[j].seq
+}
 
-    //Get system
-    file, err = os.Open(system_path)
-    if err != nil {
-        log.Fatal(err)
-    }
-    defer file.Close()
-    scanner = bufio.NewScanner(file)
+func (q event_queue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
 
-    i,j = 0,0
-    for scanner.Scan() {
-        line := scanner.Text()
-        switch i{
-        case 0:
-            n, _ := strconv.Atoi(line)
-            system = make([][]railway, n)
-            for i:=0; i<n; i++ {
-                system[i] = make([]railway, n)
-            }
-        case 1:
-        default:
-            tokens := strings.Split(line, " ")
-            vertex1,_ := strconv.Atoi(tokens[0])
-            vertex2,_ := strconv.Atoi(tokens[1])
+func (q *event_queue) Push(x interface{}) { *q = append(*q, x.(sim_event)) }
 
-            system[vertex1][vertex2] = railways[j]
-            j++
-        }
-        i++
-    }
+func (q *event_queue) Pop() interface{} {
+    old := *q
+    n := len(old)
+    item := old[n-1]
+    *q = old[:n-1]
+    return item
+}
 
-    //Get stations
-    file, err = os.Open(stations_path)
-    if err != nil {
-        log.Fatal(err)
-    }
-    defer file.Close()
-    scanner = bufio.NewScanner(file)
+//virtual clock, lets exactly one actor run at a time
+//so results do not depend on real time or CPU load
+//control is handed over through wake and yield channels, so state shared
+//by actors (stations, railways, trains) needs no locks as long as
+//it is only touched from inside an actor, a console command or after run returns
+type event_scheduler struct {
+    now         time.Duration //simulated time since start_time
+    seq         int
+    queue       event_queue
+    current     *actor    //actor running right now
+    actors      []*actor
+    yield       chan bool //running actor gives control back
+    time_rate   float64   //real time pacing, 0 = none
+    end_reason  string    //set by finish, stops run
+    exit_code   int
+    commands    chan func() //console commands, run between two actors
+    after_step  func()      //run after every step of an actor, nil = nothing
+    paused      bool        //only console commands run
+    held        int         //trains held by console, run is not deadlocked while they can be released
+}
 
-    i,j = 0,0
-    for scanner.Scan() {
-        line := scanner.Text()
-        switch i{
-        case 0:
-            n, _ := strconv.Atoi(line)
-            stations = make([]station, n)
-        case 1:
-        default:
-            tokens := strings.Split(line, " ")
-            name := tokens[0]
-            platforms,_ := strconv.Atoi(tokens[1])
-            depots,_ := strconv.Atoi(tokens[2])
-            wait_time,_ := strconv.ParseFloat(tokens[3], 64)
-            free_platforms := make(chan bool, platforms)
-            free_depots := make(chan bool, depots)
-            vertex_index,_ := strconv.Atoi(tokens[4])
-            for i:=0; i<platforms; i++ {
-                free_platforms <- true
-            }
-            for i:=0; i<depots; i++ {
-                free_depots <- true
-            }
-            stations[j] = station{name:name, free_platforms:free_platforms, free_depots:free_depots, wait_time: wait_time, vertex_index:vertex_index}
-            j++
-        }
-        i++
+func new_event_scheduler(time_rate float64) *event_scheduler {
+    return &event_scheduler{yield: make(chan bool), time_rate: time_rate}
+}
+
+//start new actor, it runs for the first time at current simulated time
+func (s *event_scheduler) spawn(name string, fn func()) *actor {
+    a := &actor{name: name, wake: make(chan bool)}
+    s.actors = append(s.actors, a)
+    s.schedule(a, 0)
+    go func() {
+        <-a.wake
+        fn()
+        a.done = true
+        s.yield <- true
+    }()
+    return a
+}
+
+//wake actor up after delay of simulated time
+func (s *event_scheduler) schedule(a *actor, delay time.Duration) {
+    a.waiting = false
+    a.wakeup = s.seq
+    heap.Push(&s.queue, sim_event{at: s.now + delay, seq: s.seq, actor: a})
+    s.seq++
+}
+
+//give control back to scheduler and wait until woken up
+func (s *event_scheduler) block(a *actor) {
+    s.yield <- true
+    <-a.wake
+}
+
+//pause calling actor for d of simulated time,
+//returns error if simulation is cancelled in the meantime
+func (s *event_scheduler) sleep(ctx context.Context, d time.Duration) error {
+    if err := ctx.Err(); err != nil {
+        return err
     }
+    a := s.current
+    s.schedule(a, d)
+    s.block(a)
+    return ctx.Err()
+}
 
-   //Get trains
-    file, err = os.Open(trains_path)
-    if err != nil {
-        log.Fatal(err)
+//like sleep, but interrupt can wake actor before d has passed,
+//returns simulated time which was left
+func (s *event_scheduler) sleep_interruptible(ctx context.Context, d time.Duration) (time.Duration, error) {
+    if err := ctx.Err(); err != nil {
+        return d, err
     }
-    defer file.Close()
-    scanner = bufio.NewScanner(file)
+    a := s.current
+    until := s.now + d
+    a.interruptible = true
+    s.schedule(a, d)
+    s.block(a)
+    a.interruptible = false
+    return until - s.now, ctx.Err()
+}
 
-    i,j = 0,0
-    for scanner.Scan() {
-        line := scanner.Text()
-        switch i{
-        case 0:
-            n, _ := strconv.Atoi(line)
-            trains = make([]train, n)
-        case 1:
-        default:
-            tokens := strings.Split(line, " ")
-            name := tokens[0]
-            capacity,_ := strconv.Atoi(tokens[1])
-            speed,_ := strconv.ParseFloat(tokens[2],64)
-            path_string := strings.Split(tokens[3], "-")
-            path_int := make([]int, len(path_string))
-            current_strech := make([]int, 2)
-            repaired := make(chan bool, 1)
-            for k:=0; k<len(path_string);k++{
-                path_int[k],_ = strconv.Atoi(path_string[k])
-            }
-            trains[j] = train{name:name, capacity:capacity,speed:speed, path: path_int, current_strech:current_strech, repaired:repaired}
-            j++
+//wake actor sleeping in sleep_interruptible or waiting in acquire_interruptible now,
+//its pending wake up is cancelled
+//returns false if actor does not sleep that way
+func (s *event_scheduler) interrupt(a *actor) bool {
+    if a == nil || a.done || !a.interruptible {
+        return false
+    }
+    a.interruptible = false
+    if t := a.blocked_on; t != nil {
+        for k := range t.waiting {
+            if t.waiting[k] == a {
+                t.waiting = append(t.waiting[:k], t.waiting[k+1:]...)
+                break
+            }
         }
-        i++
+        a.blocked_on = nil
     }
+    s.schedule(a, 0)
+    return true
+}
 
-    //Get vertex set
-    file, err = os.Open(vertex_set_path)
-    if err != nil {
-        log.Fatal(err)
-    }
-    defer file.Close()
-    scanner = bufio.NewScanner(file)
+//process events in time order until limit (0 = no limit) or ctx is cancelled
+func (s *event_scheduler) run(ctx context.Context, limit time.Duration) {
+    for len(s.queue) > 0 {
+        s.take_commands(ctx)
+        if ctx.Err() != nil {
+            return
+        }
 
-    i,j = 0,0
-    switches_count, stations_count := 0,0
-    for scanner.Scan() {
-        line := scanner.Text()
-        switch i{
-        case 0:
-            n, _ := strconv.Atoi(line)
-            vertex_set = make([]vertex, n)
-        case 1:
-        default:
-            tokens := strings.Split(line, " ")
-            typ,_ := strconv.Atoi(tokens[0])
+        ev := heap.Pop(&s.queue).(sim_event)
+        if ev.actor.done || ev.seq != ev.actor.wakeup { //cancelled by interrupt
+            continue
+        }
+        if limit > 0 && ev.at > limit {
+            s.now = limit
+            return
+        }
+        if s.time_rate > 0 {
+            started := time.Now()
+            select {
+                case <-time.After(time.Duration(float64(ev.at - s.now) / s.time_rate)):
+                case cmd := <-s.commands:
+                    //clock goes on up to the command, event waits for its turn again
+                    s.now += time.Duration(float64(time.Since(started)) * s.time_rate)
+                    if s.now > ev.at {
+                        s.now = ev.at
+                    }
+                    heap.Push(&s.queue, ev)
+                    cmd()
+                    continue
+                case <-ctx.Done():
+                    heap.Push(&s.queue, ev)
+                    return
+            }
+        }
+        s.now = ev.at
+        s.current = ev.actor
+        ev.actor.wake <- true
+        <-s.yield
+        if s.after_step != nil {
+            s.after_step()
+        }
 
-            if typ == RAIL_SWITCH {
-                vertex_set[j] = vertex{vertex_type: typ, index:switches_count}
-                switches_count++
-            } else {
-                vertex_set[j] = vertex{vertex_type: typ, index:stations_count}
-                stations_count++
+        if s.end_reason == "" {
+            if reason := s.deadlocked(); reason != "" {
+                s.finish(reason, EXIT_DEADLOCK)
             }
-            j++
         }
-        i++
+        if s.end_reason != "" {
+            return
+        }
     }
+}
 
-    //Get rail switches
-    file, err = os.Open(switches_path)
-    if err != nil {
-        log.Fatal(err)
+//stop simulation after running actor yields
+func (s *event_scheduler) finish(reason string, exit_code int) {
+    if s.end_reason == "" {
+        s.end_reason = reason
+        s.exit_code = exit_code
     }
-    defer file.Close()
-    scanner = bufio.NewScanner(file)
-
-    i,j = 0,0
-    for scanner.Scan() {
-        line := scanner.Text()
-        switch i{
-        case 0:
-            n, _ := strconv.Atoi(line)
-            rail_switches = make([]rail_switch, n)
-        case 1:
-        default:
-            tokens := strings.Split(line, " ")
-            time,_ := strconv.ParseFloat(tokens[0], 64)
-            vertex_index,_ := strconv.Atoi(tokens[1])
-            is_free := make(chan bool, 1)
-            is_free <- true
-            rotating := make(chan bool, 1)
-            rotate_done := make(chan bool, 1)
+}
 
-            
-            rail_switches[j] = rail_switch{wait_time: time, is_free:is_free, rotating:rotating, rotate_done:rotate_done, vertex_index:vertex_index}
-            j++
+//run waiting console commands, while paused wait for the next one
+func (s *event_scheduler) take_commands(ctx context.Context) {
+    for {
+        if s.paused {
+            select {
+                case cmd := <-s.commands:
+                    cmd()
+                case <-ctx.Done():
+                    return
+            }
+            continue
+        }
+        select {
+            case cmd := <-s.commands:
+                cmd()
+            default:
+                return
         }
-        i++
     }
-
-    return system, stations, trains, vertex_set, rail_switches
 }
 
-
-// Dijkstra's algorithm to find shortest path from s to destin
-func dijkstra(G [][]railway, src int, destin int) []int {
-    n := len(G)
-    dist := make([]int, n)
-    pred := make([]int, n)  // preceeding node in path
-    visited := make([]bool, n) // all false initially
-  
-    for i:=0; i<n; i++ {
-        dist[i] = 30000 //very big value
+//reason to stop if every actor which could make progress waits for another one,
+//or if some of them wait in a cycle for tokens held by each other, empty if not deadlocked
+func (s *event_scheduler) deadlocked() string {
+    all := s.held == 0
+    for _, a := range s.actors {
+        if !a.done && !a.background && !a.waiting {
+            all = false
+        }
+    }
+    if all {
+        return "deadlock, no train can move"
     }
-    dist[src] = 0
-  
-    for i:=0; i<n; i++ {
-        next := minVertex(dist, visited)
-        visited[next] = true
 
-        neighbors := make([]int,0)
-        for i:=0;i<n;i++{
-            if G[next][i].length > 0{
-                neighbors = append(neighbors,i)
-            }
+    //actors waiting for a token are stuck while every holder of it is stuck too,
+    //what is left after dropping the others waits in a cycle
+    stuck := map[*actor]bool{}
+    for _, a := range s.actors {
+        if !a.done && !a.background && a.waiting && a.blocked_on != nil {
+            stuck[a] = true
         }
-
-        for j:=0; j<len(neighbors); j++ {
-            v := neighbors[j];
-            d := dist[next] + int(G[next][v].length);
-            if dist[v] > d {
-                dist[v] = d
-                pred[v] = next
+    }
+    for changed := true; changed; {
+        changed = false
+        for _, a := range s.actors {
+            if !stuck[a] {
+                continue
+            }
+            free := len(a.blocked_on.holders) == 0
+            for _, h := range a.blocked_on.holders {
+                free = free || !stuck[h]
+            }
+            if free {
+                delete(stuck, a)
+                changed = true
             }
         }
     }
-
-    returnPath := make([]int,0)
-    for destin != src {
-        returnPath = append([]int{destin}, returnPath...)
-        destin = pred[destin]
+    if len(stuck) == 0 {
+        return ""
     }
-    returnPath = append([]int{src},returnPath...)
-
-    return returnPath
+    var names []string
+    for _, a := range s.actors {
+        if stuck[a] {
+            names = append(names, a.name)
+        }
+    }
+    return "deadlock, " + strings.Join(names, ", ") + " wait for each other"
 }
 
-//Dijkstra helper function
-func minVertex (dist []int, v []bool) int {
-    x := 30000 //very big value
-    y := -1   // graph not connected, or no unvisited vertices
-    for  i:=0; i<len(dist); i++ {
-        if !v[i] && dist[i]<x {
-            y=i
-            x=dist[i]
+//wake every actor once more after ctx is cancelled,
+//blocking calls return error so actors can clean up and return
+func (s *event_scheduler) shutdown() {
+    for k:=0; k<len(s.actors); k++ {
+        a := s.actors[k]
+        if !a.done {
+            s.current = a
+            a.wake <- true
+            <-s.yield
         }
     }
-    return y
 }
 
-//reverse array
-func reverse(numbers []int) []int {
-    for i, j := 0, len(numbers)-1; i < j; i, j = i+1, j-1 {
-        numbers[i], numbers[j] = numbers[j], numbers[i]
-    }
-    return numbers
+//counting semaphore in simulated time, replaces buffered chan bool tokens
+type sim_semaphore struct {
+    free    int
+    waiting []*actor
+    holders []*actor //actors which took a token and did not give it back, for deadlock detection
 }
 
+func new_sim_semaphore(n int) *sim_semaphore {
+    return &sim_semaphore{free: n}
+}
 
-//display logs to terminal and save to file
-func logs(file *os.File, line ... string) {
-    output := ""
-    time := get_current_simulator_time_as_string()
-    for i:=0; i<len(line); i++{
-        output += line[i] + " "
+//take token, block calling actor until one is free
+func (t *sim_semaphore) acquire(ctx context.Context) error {
+    if err := ctx.Err(); err != nil {
+        return err
     }
-    output += "\n"
-    if !SILENT_MODE {
-        fmt.Println(time,"\n   ", output)
+    if t.free > 0 {
+        t.free--
+        t.holders = append(t.holders, scheduler.current)
+        return nil
     }
-    file.WriteString(time + "   " + output)
+    a := scheduler.current
+    a.waiting = true
+    a.blocked_on = t
+    t.waiting = append(t.waiting, a)
+    scheduler.block(a)
+    a.blocked_on = nil
+    return ctx.Err()
 }
 
-
-//thread for every rail switch
-func start_rail_switch(switch_unit rail_switch) {
-    for {
-            //wait until some train ask for rotating
-            <- switch_unit.rotating
-            time.Sleep(time.Millisecond * time.Duration(switch_unit.wait_time * 60000 / TIME_RATE))
-            //rotate done, give train permission to continue
-            switch_unit.rotate_done <- true
+//true if actor has taken a token and not given it back
+func (t *sim_semaphore) held_by(a *actor) bool {
+    for _, h := range t.holders {
+        if h == a {
+            return true
+        }
     }
+    return false
 }
 
+//like acquire, but interrupt can stop waiting, returns false then
+func (t *sim_semaphore) acquire_interruptible(ctx context.Context) (bool, error) {
+    return t.take(ctx, false)
+}
 
-//try to broke something sometimes
-func crash(repair_vehicle_unit repair_vehicle, trains []train, system [][]railway, rail_switches []rail_switch) {
-    for {
-        time.Sleep(time.Millisecond * time.Duration(360000/TIME_RATE))
-
-        if rand.Float32() < CRASH_RATE && !crash_active {
-            choice := rand.Intn(3)
-            switch choice {
-                case 0: //crash railway
-                    v1 := rand.Intn(len(system))
-                    v2 := rand.Intn(len(system))
-                    for system[v1][v2].is_free == nil{
-                        v1 = rand.Intn(len(system))
-                        v2 = rand.Intn(len(system))
-                    }
-                    logs(nil, "Railway crashed ", strconv.Itoa(v1),"====", strconv.Itoa(v2))
-                    crash_active = true
-                    //dont allow to use railway by other trains
-                    <-system[v1][v2].is_free
-                    //send information to repair vehicle about crashed railway
-                    repair_vehicle_unit.railway_crash <- v1
-                    repair_vehicle_unit.railway_crash <- v2
-
-                case 1: //crash train
-                    indx := rand.Intn(len(trains))
-                    trains[indx].broken = true
-                    crash_active = true
-                    logs(nil, "Train",trains[indx].name,"has crashed")
-                    repair_vehicle_unit.train_crash <- indx
+//like acquire_interruptible, but calling actor gets token before every actor waiting already,
+//so a failed asset is out of service as soon as the train using it leaves
+func (t *sim_semaphore) seize(ctx context.Context) (bool, error) {
+    return t.take(ctx, true)
+}
 
-                case 2: //crash switch
-                    indx := rand.Intn(len(rail_switches))
-                    crash_active = true
-                    logs(nil, "Railswitch crashed at vertex", strconv.Itoa(rail_switches[indx].vertex_index))
-                    //dont allow to use rail switch by other trains
-                    <- rail_switches[indx].is_free 
-                    repair_vehicle_unit.rail_switch_crash <- rail_switches[indx].vertex_index
-            }       
-        }
+func (t *sim_semaphore) take(ctx context.Context, first bool) (bool, error) {
+    if err := ctx.Err(); err != nil {
+        return false, err
     }
+    if t.free > 0 {
+        t.free--
+        t.holders = append(t.holders, scheduler.current)
+        return true, nil
+    }
+    a := scheduler.current
+    a.waiting = true
+    a.interruptible = true
+    a.blocked_on = t
+    if first {
+        t.waiting = append([]*actor{a}, t.waiting...)
+    } else {
+        t.waiting = append(t.waiting, a)
+    }
+    scheduler.block(a)
+    granted := a.blocked_on == t //interrupt clears it
+    a.blocked_on = nil
+    a.interruptible = false
+    return granted, ctx.Err()
 }
 
-//initialize the repair vehicle with paremeters
-func init_repair_vehicle(repair_vehicle_unit repair_vehicle) repair_vehicle {
-    //initialize channels in order to communicate
-
-    repair_vehicle_unit.name = REPAIR_VEHICLE_NAME
-    repair_vehicle_unit.speed = REPAIR_VEHICLE_SPEED
-    repair_vehicle_unit.STATION_VERTEX = STATION_VERTEX
-    repair_vehicle_unit.path = make([]int, 0)
-    repair_vehicle_unit.rail_switch_crash = make(chan int,1)
-    repair_vehicle_unit.train_crash = make(chan int, 1)
-    repair_vehicle_unit.railway_crash = make(chan int, 2)
+//take token even if none is free, for repair vehicle passing trains which wait for an incident,
+//free stays below zero until it is given back, so no waiting actor gets a token meanwhile
+func (t *sim_semaphore) possess() {
+    t.free--
+    t.holders = append(t.holders, scheduler.current)
+}
 
-    return repair_vehicle_unit
+//give token of running actor back, first waiting actor gets it directly
+func (t *sim_semaphore) release() {
+    t.release_holder(scheduler.current)
 }
 
+//give token taken by actor back, which may be another one than the running actor,
+//like a failed asset given back by its repair
+func (t *sim_semaphore) release_holder(a *actor) {
+    for i, h := range t.holders {
+        if h == a {
+            t.holders = append(t.holders[:i], t.holders[i+1:]...)
+            break
+        }
+    }
+    if t.free >= 0 && len(t.waiting) > 0 {
+        w := t.waiting[0]
+        t.waiting = t.waiting[1:]
+        w.interruptible = false
+        t.holders = append(t.holders, w)
+        scheduler.schedule(w, 0)
+        return
+    }
+    t.free++
+}
 
-func send_repair_vehicle(f *os.File, repair_type int, repair_vehicle_unit repair_vehicle, trains []train, system [][]railway, rail_switches []rail_switch, vertex_set []vertex, stations []station){
-    for i:=0; i<len(repair_vehicle_unit.path)-1 ;i++{
-        start := repair_vehicle_unit.path[i]
-        end := repair_vehicle_unit.path[i+1]
+//unbounded mailbox between actors in simulated time
+type sim_channel struct {
+    items   []interface{}
+    waiting []*actor
+}
 
-        logs(f, "Repair vehicle is now on railway",strconv.Itoa(start),"->",strconv.Itoa(end))
+func new_sim_channel() *sim_channel {
+    return &sim_channel{}
+}
 
-        //count the needed time to travel and wait
-        real_world_travel_time_in_ms := get_travel_time(system[start][end].length, repair_vehicle_unit.speed, system[start][end].max_speed)
-        in_program_travel_time_in_ms := real_world_travel_time_in_ms / TIME_RATE //fasten time with TIME_RATE multiplier
-        time.Sleep(time.Duration(in_program_travel_time_in_ms) * time.Millisecond)
+func (c *sim_channel) send(item interface{}) {
+    c.items = append(c.items, item)
+    if len(c.waiting) > 0 {
+        a := c.waiting[0]
+        c.waiting = c.waiting[1:]
+        scheduler.schedule(a, 0)
+    }
+}
 
-        if vertex_set[end].vertex_type == RAIL_SWITCH {
-            logs(f, "Repair vehicle is on railway switch at vertex", strconv.Itoa(end))
-        } else {
-            logs(f, "Repair vehicle is on station ", stations[vertex_set[end].index].name)
+//take first item, block calling actor until there is one
+func (c *sim_channel) receive(ctx context.Context) (interface{}, error) {
+    for len(c.items) == 0 {
+        if err := ctx.Err(); err != nil {
+            return nil, err
         }
+        a := scheduler.current
+        a.waiting = true
+        c.waiting = append(c.waiting, a)
+        scheduler.block(a)
     }
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    item := c.items[0]
+    c.items = c.items[1:]
+    return item, nil
 }
 
 
-func start_repair_vehicle(repair_vehicle_unit repair_vehicle, trains []train, system [][]railway, rail_switches []rail_switch, vertex_set []vertex, stations []station) {
+/* Simulator time functions */
 
-    //log file
-    f, _ := os.Create("logs/"+repair_vehicle_unit.name)
-    defer f.Close()
+func get_current_simulator_time() time.Time {
+    return start_time.Add(scheduler.now)
+}
 
-    //keep waiting for crash
-    for {
-        select {
-            case train_index := <-repair_vehicle_unit.train_crash:
-                logs(f, "Repair vehicle has taken an order to repair train", trains[train_index].name, "at vertex", strconv.Itoa(trains[train_index].current_strech[1]))
-                //find path to destination
-                repair_vehicle_unit.path = dijkstra(system, repair_vehicle_unit.STATION_VERTEX, trains[train_index].current_strech[1])
-                
-                send_repair_vehicle(f, TRAIN_REPAIR ,repair_vehicle_unit, trains, system, rail_switches, vertex_set, stations)
-                
-                //repair
-                time.Sleep(time.Duration(TRAIN_REPAIR_TIME_H*3600000/TIME_RATE) * time.Millisecond)
-                trains[train_index].repaired <- true
-                trains[train_index].broken = false
-                logs(f, "Repair vehicle has repaired the train",trains[train_index].name)
+func get_current_simulator_time_as_string() string {
+    return get_current_simulator_time().Format("2006-01-02 15:04")
+}
 
-                repair_vehicle_unit.path = reverse(repair_vehicle_unit.path)
-                send_repair_vehicle(f, -1 ,repair_vehicle_unit, trains, system, rail_switches, vertex_set, stations)
+//return travel time in simulated miliseconds
+func get_travel_time(km float64, train_kmh float64, rail_max_speed float64) float64{
+    speed_in_kmh := math.Min(train_kmh, rail_max_speed)
+    travel_time_in_h := km/speed_in_kmh
+    return travel_time_in_h*3600000
+}
 
-                logs(f, "Repair vehicle has ended its job, returned to station at vertex", strconv.Itoa(repair_vehicle_unit.STATION_VERTEX))
-                crash_active = false
-                
+/* Repair time distributions */
+
+//random duration
+type distribution struct {
+    kind    string //DIST_*
+    a       time.Duration //fixed value, lower bound, mean or median
+    b       time.Duration //upper bound of uniform
+    sigma   float64       //of lognormal
+    values  []time.Duration //histogram bins
+    weights []float64       //cumulative weight of bins
+    text    string
+}
 
-            case rail_switch_vertex_index := <-repair_vehicle_unit.rail_switch_crash:
-                logs(f, "Repair vehicle has taken an order to repair rail switch at vertex", strconv.Itoa(rail_switch_vertex_index))
+func fixed_distribution(d time.Duration) distribution {
+    return distribution{kind: DIST_FIXED, a: d, text: d.String()}
+}
 
-                //find path to destination
-                repair_vehicle_unit.path = dijkstra(system, repair_vehicle_unit.STATION_VERTEX, rail_switch_vertex_index)
-                
-                send_repair_vehicle(f, RAIL_SWITCH_REPAIR ,repair_vehicle_unit, trains, system, rail_switches, vertex_set, stations)
-                
-                //repair
-                time.Sleep(time.Duration(RAIL_SWITCH_REPAIR_TIME_H*3600000/TIME_RATE) * time.Millisecond)
-                rail_switches[vertex_set[rail_switch_vertex_index].index].is_free <- true
-                logs(f, "Repair vehicle has repaired rail switch at vertex", strconv.Itoa(rail_switch_vertex_index))
+//parse distribution written as:
+//  2h                  fixed
+//  uniform:1h,3h       uniform between two durations
+//  exp:2h              exponential with mean
+//  lognormal:2h,0.5    lognormal with median and sigma
+//  hist:1h=2,2h=5,4h=1 empirical histogram of duration=weight
+func parse_distribution(text string) (distribution, error) {
+    d := distribution{text: text}
+    kind, args := DIST_FIXED, text
+    if k := strings.Index(text, ":"); k >= 0 {
+        kind, args = strings.TrimSpace(text[:k]), text[k+1:]
+    }
+    parts := strings.Split(args, ",")
+    duration := func(s string) (time.Duration, error) {
+        v, err := time.ParseDuration(strings.TrimSpace(s))
+        if err == nil && v < 0 {
+            err = fmt.Errorf("negative duration %s", s)
+        }
+        return v, err
+    }
+    arguments := func(n int) error {
+        if len(parts) != n {
+            return fmt.Errorf("%s needs %d values, got %d", kind, n, len(parts))
+        }
+        return nil
+    }
+
+    var err error
+    switch kind {
+        case DIST_FIXED, DIST_EXPONENTIAL:
+            if err = arguments(1); err == nil {
+                d.a, err = duration(parts[0])
+            }
+        case DIST_UNIFORM:
+            if err = arguments(2); err == nil {
+                if d.a, err = duration(parts[0]); err == nil {
+                    d.b, err = duration(parts[1])
+                }
+            }
+            if err == nil && d.b < d.a {
+                err = fmt.Errorf("upper bound %v is less than lower bound %v", d.b, d.a)
+            }
+        case DIST_LOGNORMAL:
+            if err = arguments(2); err == nil {
+                if d.a, err = duration(parts[0]); err == nil {
+                    d.sigma, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+                }
+            }
+            if err == nil && d.sigma < 0 {
+                err = fmt.Errorf("negative sigma %v", d.sigma)
+            }
+        case DIST_HISTOGRAM:
+            total := 0.0
+            for _, part := range parts {
+                bin := strings.SplitN(part, "=", 2)
+                if len(bin) != 2 {
+                    err = fmt.Errorf("bin %q is not duration=weight", part)
+                    break
+                }
+                v, e := duration(bin[0])
+                w, e2 := strconv.ParseFloat(strings.TrimSpace(bin[1]), 64)
+                if e != nil || e2 != nil || w < 0 {
+                    err = fmt.Errorf("bad bin %q", part)
+                    break
+                }
+                total += w
+                d.values = append(d.values, v)
+                d.weights = append(d.weights, total)
+            }
+            if err == nil && total <= 0 {
+                err = fmt.Errorf("histogram weights sum to 0")
+            }
+        default:
+            err = fmt.Errorf("unknown distribution %q, must be fixed, %s, %s, %s or %s", kind, DIST_UNIFORM, DIST_EXPONENTIAL, DIST_LOGNORMAL, DIST_HISTOGRAM)
+    }
+    if err != nil {
+        return d, fmt.Errorf("repair time %q: %v", text, err)
+    }
+    d.kind = kind
+    return d, nil
+}
+
+//flag.Value, so distributions can be given on command line
+func (d *distribution) String() string {
+    return d.text
+}
+
+func (d *distribution) Set(text string) error {
+    v, err := parse_distribution(text)
+    if err != nil {
+        return err
+    }
+    *d = v
+    return nil
+}
+
+//random duration rounded to seconds, fixed distribution does not use rng so runs without
+//random repair times draw the same crashes as before
+func (d distribution) draw(rng *rand.Rand) time.Duration {
+    var v time.Duration
+    switch d.kind {
+        case DIST_UNIFORM:
+            v = d.a + time.Duration(rng.Float64() * float64(d.b - d.a))
+        case DIST_EXPONENTIAL:
+            v = time.Duration(rng.ExpFloat64() * float64(d.a))
+        case DIST_LOGNORMAL:
+            v = time.Duration(float64(d.a) * math.Exp(d.sigma * rng.NormFloat64()))
+        case DIST_HISTOGRAM:
+            x := rng.Float64() * d.weights[len(d.weights)-1]
+            v = d.values[len(d.values)-1]
+            for k, w := range d.weights {
+                if x < w {
+                    v = d.values[k]
+                    break
+                }
+            }
+        default:
+            return d.a
+    }
+    return v.Round(time.Second)
+}
+
+//mean of distribution, used to estimate when vehicle is free again
+func (d distribution) mean() time.Duration {
+    switch d.kind {
+        case DIST_UNIFORM:
+            return (d.a + d.b) / 2
+        case DIST_LOGNORMAL:
+            return time.Duration(float64(d.a) * math.Exp(d.sigma * d.sigma / 2))
+        case DIST_HISTOGRAM:
+            sum, last := 0.0, 0.0
+            for k, w := range d.weights {
+                sum += float64(d.values[k]) * (w - last)
+                last = w
+            }
+            return time.Duration(sum / last)
+    }
+    return d.a
+}
+
+/* Failure models */
+
+//failure model of asset, written as "500h,shape=1.5,km=20000":
+//  500h            mean time between failures of asset as good as new
+//  shape=1.5       weibull shape of age hazard, 1 = constant, > 1 wears out with age since last repair
+//  km=20000        mean km travelled between failures, trains and railways
+//  rotations=800   mean rotations between failures, rail switches
+type failure_model struct {
+    mtbf    time.Duration //0 = no age hazard
+    shape   float64
+    usage   float64 //mean usage between failures, 0 = no usage hazard
+    unit    string  //USAGE_KM or USAGE_ROTATIONS, set before parsing
+    text    string
+}
+
+func parse_failure_model(text string, unit string) (failure_model, error) {
+    m := failure_model{shape: 1, unit: unit, text: text}
+    for _, part := range strings.Split(text, ",") {
+        part = strings.TrimSpace(part)
+        kv := strings.SplitN(part, "=", 2)
+        if len(kv) == 1 {
+            d, err := time.ParseDuration(part)
+            if err != nil || d <= 0 {
+                return m, fmt.Errorf("failure model %q: %q is not a positive duration", text, part)
+            }
+            m.mtbf = d
+            continue
+        }
+        v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+        if err != nil || v <= 0 {
+            return m, fmt.Errorf("failure model %q: %s must be a positive number", text, kv[0])
+        }
+        switch key := strings.TrimSpace(kv[0]); key {
+            case "shape":
+                m.shape = v
+            case USAGE_KM, USAGE_ROTATIONS:
+                if key != unit {
+                    return m, fmt.Errorf("failure model %q: usage of this asset is counted in %s", text, unit)
+                }
+                m.usage = v
+            default:
+                return m, fmt.Errorf("failure model %q: unknown parameter %q", text, key)
+        }
+    }
+    if m.mtbf == 0 && m.usage == 0 {
+        return m, fmt.Errorf("failure model %q: needs mean time or %s between failures", text, unit)
+    }
+    return m, nil
+}
+
+//flag.Value, unit is kept from default
+func (m *failure_model) String() string {
+    return m.text
+}
+
+func (m *failure_model) Set(text string) error {
+    v, err := parse_failure_model(text, m.unit)
+    if err != nil {
+        return err
+    }
+    *m = v
+    return nil
+}
+
+func (m failure_model) set() bool {
+    return m.mtbf > 0 || m.usage > 0
+}
+
+//cumulative age hazard of weibull distribution with mean mtbf
+func (m failure_model) hazard(age time.Duration) float64 {
+    if m.mtbf <= 0 {
+        return 0
+    }
+    scale := float64(m.mtbf) / math.Gamma(1 + 1/m.shape)
+    return math.Pow(float64(age) / scale, m.shape)
+}
+
+//chance to fail while aging from age0 to age1 and using asset meanwhile
+func (m failure_model) chance(age0 time.Duration, age1 time.Duration, used float64) float64 {
+    h := m.hazard(age1) - m.hazard(age0)
+    if m.usage > 0 {
+        h += used / m.usage
+    }
+    return 1 - math.Exp(-h)
+}
+
+//reliability state of railway, rail switch or train
+type asset_health struct {
+    failure     *failure_model //own model, nil = model of settings for asset type
+    since       time.Duration  //last repair, age is counted from it
+    usage       float64        //since last repair
+    checked     float64        //usage at last failure roll
+    total       float64        //usage since start
+    history     []failure_record
+}
+
+//one failure of asset
+type failure_record struct {
+    incident    int
+    at          time.Duration
+    age         time.Duration //since last repair
+    usage       float64       //since last repair
+}
+
+func (h *asset_health) use(amount float64) {
+    h.usage += amount
+    h.total += amount
+}
+
+//add failure to history, return text for crash event
+func (h *asset_health) fail(incident int, unit string) string {
+    r := failure_record{incident: incident, at: scheduler.now, age: scheduler.now - h.since, usage: h.usage}
+    h.history = append(h.history, r)
+    return fmt.Sprintf("age %v, %.0f %s since repair", r.age.Round(time.Minute), r.usage, unit)
+}
+
+//repaired asset is as good as new
+func (h *asset_health) repaired() {
+    h.since = scheduler.now
+    h.usage = 0
+    h.checked = 0
+}
+
+/* Input data reading function */
+
+//problem found in input data
+type input_error struct {
+    file    string
+    line    int //0 if problem is not bound to a line
+    message string
+}
+
+func (e input_error) Error() string {
+    if e.line > 0 {
+        return fmt.Sprintf("%s:%d: %s", e.file, e.line, e.message)
+    }
+    return fmt.Sprintf("%s: %s", e.file, e.message)
+}
+
+//all problems found in input data
+type input_errors []input_error
+
+func (errs *input_errors) add(file string, line int, format string, args ...interface{}) {
+    *errs = append(*errs, input_error{file: file, line: line, message: fmt.Sprintf(format, args...)})
+}
+
+//data line of input file
+type table_row struct {
+    line    int
+    tokens  []string
+}
+
+//input file, first line is number of rows, second line names columns,
+//columns may come in any order, a column name ending with ? may be left out
+type table struct {
+    path        string
+    columns     []string
+    pos         []int //position of every column in rows, -1 for left out optional column
+    width       int   //columns in header line
+    count       int
+    count_line  int
+    lines       int   //data lines, including skipped ones
+    rows        []table_row
+}
+
+//split line into tokens, any whitespace separates them and # starts a comment
+func tokenize(line string) []string {
+    if i := strings.Index(line, "#"); i >= 0 {
+        line = line[:i]
+    }
+    return strings.Fields(line)
+}
+
+//read input file, rows with wrong number of columns are reported and skipped,
+//blank lines and comments are ignored
+func read_table(path string, columns []string, errs *input_errors) table {
+    t := table{path: path, columns: columns}
+
+    file, err := os.Open(path)
+    if err != nil {
+        errs.add(path, 0, "%v", err)
+        return t
+    }
+    defer file.Close()
+    scanner := bufio.NewScanner(file)
+
+    i, line_no := 0, 0
+    for scanner.Scan() {
+        line_no++
+        tokens := tokenize(scanner.Text())
+        if len(tokens) == 0 {
+            continue
+        }
+        i++
+        switch i{
+        case 1:
+            n, err := strconv.Atoi(tokens[0])
+            if err != nil || n < 0 || len(tokens) != 1 {
+                errs.add(path, line_no, "bad row count %q", strings.Join(tokens, " "))
+                continue
+            }
+            t.count = n
+            t.count_line = line_no
+        case 2:
+            t.read_header(tokens, line_no, errs)
+        default:
+            t.lines++
+            if t.pos == nil {
+                continue
+            }
+            if len(tokens) != t.width {
+                errs.add(path, line_no, "expected %d columns (%s), got %d", t.width, strings.Join(t.header(), " "), len(tokens))
+                continue
+            }
+            t.rows = append(t.rows, table_row{line: line_no, tokens: tokens})
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        errs.add(path, line_no, "%v", err)
+    }
+    if i < 2 {
+        errs.add(path, 0, "missing row count or header line")
+    }
+    return t
+}
+
+//find every expected column in header line, names are case insensitive
+func (t *table) read_header(tokens []string, line int, errs *input_errors) {
+    pos := make([]int, len(t.columns))
+    ok := true
+    for col, name := range t.columns {
+        pos[col] = -1
+        for k, token := range tokens {
+            if strings.EqualFold(token, t.name(col)) {
+                pos[col] = k
+            }
+        }
+        if pos[col] < 0 && !strings.HasSuffix(name, "?") {
+            errs.add(t.path, line, "header has no %s column", name)
+            ok = false
+        }
+    }
+    for _, token := range tokens {
+        known := false
+        for col := range t.columns {
+            known = known || strings.EqualFold(token, t.name(col))
+        }
+        if !known {
+            errs.add(t.path, line, "unknown column %s", token)
+            ok = false
+        }
+    }
+    if ok {
+        t.pos, t.width = pos, len(tokens)
+    }
+}
+
+//name of column without optional mark
+func (t table) name(col int) string {
+    return strings.TrimSuffix(t.columns[col], "?")
+}
+
+//column names in order used by file
+func (t table) header() []string {
+    names := make([]string, t.width)
+    for col := range t.columns {
+        if t.pos[col] >= 0 {
+            names[t.pos[col]] = t.name(col)
+        }
+    }
+    return names
+}
+
+//first line of most files is number of rows
+func (t table) check_count(errs *input_errors) {
+    if t.lines != t.count {
+        errs.add(t.path, t.count_line, "row count is %d but file has %d rows", t.count, t.lines)
+    }
+}
+
+//raw value of column, empty for left out optional column
+func (t table) text(row table_row, col int) string {
+    if t.pos[col] < 0 {
+        return ""
+    }
+    return row.tokens[t.pos[col]]
+}
+
+//integer value of column
+func (t table) int(row table_row, col int, errs *input_errors) int {
+    n, err := strconv.Atoi(t.text(row, col))
+    if err != nil {
+        errs.add(t.path, row.line, "%s: bad integer %q", t.name(col), t.text(row, col))
+    }
+    return n
+}
+
+//number value of column, must be greater than 0
+func (t table) positive(row table_row, col int, errs *input_errors) float64 {
+    x, err := strconv.ParseFloat(t.text(row, col), 64)
+    if err != nil {
+        errs.add(t.path, row.line, "%s: bad number %q", t.name(col), t.text(row, col))
+    } else if x <= 0 {
+        errs.add(t.path, row.line, "%s: must be greater than 0, got %s", t.name(col), t.text(row, col))
+    }
+    return x
+}
+
+//first edge of route of train which is not in system, ok if all exist
+func missing_edge(t train, system [][]railway) (int, int, bool) {
+    route := t.route()
+    for k:=0; k<len(route); k++ {
+        if k == len(route)-1 && t.service == SERVICE_ONE_SHOT {
+            break
+        }
+        v1, v2 := route[k], route[(k+1) % len(route)]
+        if system[v1][v2].is_free == nil {
+            return v1, v2, false
+        }
+    }
+    return 0, 0, true
+}
+
+//vertices of one run of train, shuttle goes along path and back,
+//every service but one-shot starts the next run where it ends
+func (t *train) route() []int {
+    if t.service != SERVICE_SHUTTLE {
+        return t.path
+    }
+    route := append([]int{}, t.path...)
+    for k:=len(t.path)-2; k>0; k-- {
+        route = append(route, t.path[k])
+    }
+    return route
+}
+
+//problem of service of train, empty if there is none,
+//shuttle and one-shot trains have to end at stations
+func check_service(t train, vertex_set []vertex, stations []station) string {
+    //nil if v is no station, input data may be broken elsewhere
+    station_at := func(v int) *station {
+        if v >= len(vertex_set) || vertex_set[v].vertex_type != STATION || vertex_set[v].index < 0 || vertex_set[v].index >= len(stations) {
+            return nil
+        }
+        return &stations[vertex_set[v].index]
+    }
+    first, last := station_at(t.path[0]), station_at(t.path[len(t.path)-1])
+    switch t.service {
+        case SERVICE_CIRCULAR:
+        case SERVICE_SHUTTLE:
+            if first == nil || last == nil {
+                return "shuttle has to start and end at stations to turn around"
+            }
+        case SERVICE_ONE_SHOT:
+            if last == nil || last.free_depots.free == 0 {
+                return "one-shot train has to end at a station with a depot"
+            }
+        default:
+            return fmt.Sprintf("unknown service %q, must be circular, shuttle or one-shot", t.service)
+    }
+    if t.turnaround < 0 {
+        return "turnaround must not be negative"
+    }
+    return ""
+}
+
+//text added to missing edge of circular train when it is the one back to its first vertex
+func back_edge_hint(t train, v1 int, v2 int) string {
+    if t.service == SERVICE_CIRCULAR && v1 == t.path[len(t.path)-1] && v2 == t.path[0] {
+        return " back to first vertex, trains which do not go around need service shuttle or one-shot"
+    }
+    return ""
+}
+
+//Get all data from files, every problem is reported in errs
+func read_data(
+    railways_path string,
+    system_path string,
+    trains_path string,
+    stations_path string,
+    vertex_set_path string,
+    switches_path string) ([][]railway, []station, []train, []vertex, []rail_switch, input_errors) {
+    
+    var errs input_errors
+    var railways []railway
+    var system [][]railway
+    var stations []station
+    var trains []train
+    var rail_switches []rail_switch
+    var vertex_set []vertex
+
+    //Get vertex set
+    t := read_table(vertex_set_path, []string{"TYPE"}, &errs)
+    t.check_count(&errs)
+    switches_count, stations_count := 0,0
+    for _, row := range t.rows {
+        typ := t.int(row, 0, &errs)
+
+        if typ == RAIL_SWITCH {
+            vertex_set = append(vertex_set, vertex{vertex_type: typ, index:switches_count})
+            switches_count++
+        } else if typ == STATION {
+            vertex_set = append(vertex_set, vertex{vertex_type: typ, index:stations_count})
+            stations_count++
+        } else {
+            errs.add(t.path, row.line, "TYPE: must be %d (rail switch) or %d (station), got %s", RAIL_SWITCH, STATION, t.text(row, 0))
+            vertex_set = append(vertex_set, vertex{vertex_type: STATION, index: -1})
+        }
+    }
+
+    //Get railways
+    t = read_table(railways_path, []string{"MAX_SPEED", "LENGTH"}, &errs)
+    t.check_count(&errs)
+    railway_lines := make([]int, 0)
+    for _, row := range t.rows {
+        max_speed := t.positive(row, 0, &errs)
+        length := t.positive(row, 1, &errs)
+        railways = append(railways, railway{max_speed: max_speed, length: length, is_free: new_sim_semaphore(1)})
+        railway_lines = append(railway_lines, row.line)
+    }
+
+    //Get system, first line is number of vertices, edge N uses railway N
+    t = read_table(system_path, []string{"VERTEX1", "VERTEX2"}, &errs)
+    n := t.count
+    if len(vertex_set) != n {
+        errs.add(t.path, t.count_line, "system has %d vertices but %s has %d", n, vertex_set_path, len(vertex_set))
+    }
+    system = make([][]railway, n)
+    for i:=0; i<n; i++ {
+        system[i] = make([]railway, n)
+    }
+    for j, row := range t.rows {
+        vertex1 := t.int(row, 0, &errs)
+        vertex2 := t.int(row, 1, &errs)
+
+        if vertex1 < 0 || vertex1 >= n || vertex2 < 0 || vertex2 >= n {
+            errs.add(t.path, row.line, "edge %d -> %d references unknown vertex, vertices are 0-%d", vertex1, vertex2, n-1)
+            continue
+        }
+        if j >= len(railways) {
+            errs.add(t.path, row.line, "edge %d -> %d has no railway in %s", vertex1, vertex2, railways_path)
+            continue
+        }
+        if system[vertex1][vertex2].is_free != nil {
+            errs.add(t.path, row.line, "edge %d -> %d defined twice", vertex1, vertex2)
+        }
+        system[vertex1][vertex2] = railways[j]
+    }
+    for j:=len(t.rows); j<len(railways); j++ {
+        errs.add(railways_path, railway_lines[j], "railway has no edge in %s", system_path)
+    }
+
+    //Get stations
+    t = read_table(stations_path, []string{"NAME", "PLATFORMS", "DEPOTS", "WAIT_TIME_MINUTES", "VERTEX_INDEX"}, &errs)
+    t.check_count(&errs)
+    for j, row := range t.rows {
+        name := t.text(row, 0)
+        platforms := t.int(row, 1, &errs)
+        depots := t.int(row, 2, &errs)
+        wait_time, err := strconv.ParseFloat(t.text(row, 3), 64)
+        if err != nil || wait_time < 0 {
+            errs.add(t.path, row.line, "WAIT_TIME_MINUTES: bad number %q", t.text(row, 3))
+        }
+        if platforms < 1 {
+            errs.add(t.path, row.line, "PLATFORMS: station needs at least one platform")
+        }
+        if depots < 0 {
+            errs.add(t.path, row.line, "DEPOTS: must not be negative")
+        }
+        vertex_index := t.int(row, 4, &errs)
+        if vertex_index < 0 || vertex_index >= len(vertex_set) {
+            errs.add(t.path, row.line, "VERTEX_INDEX: %d not in %s", vertex_index, vertex_set_path)
+        } else if vertex_set[vertex_index].vertex_type != STATION {
+            errs.add(t.path, row.line, "VERTEX_INDEX: vertex %d is not a station in %s", vertex_index, vertex_set_path)
+        } else if vertex_set[vertex_index].index != j {
+            errs.add(t.path, row.line, "VERTEX_INDEX: vertex %d is station number %d in %s, this is station number %d", vertex_index, vertex_set[vertex_index].index, vertex_set_path, j)
+        }
+        stations = append(stations, station{name:name, free_platforms:new_sim_semaphore(platforms), free_depots:new_sim_semaphore(depots), wait_time: wait_time, vertex_index:vertex_index, platforms: platforms})
+    }
+    if len(stations) != stations_count {
+        errs.add(t.path, 0, "%d stations but %s has %d station vertices", len(stations), vertex_set_path, stations_count)
+    }
+
+    //Get rail switches
+    t = read_table(switches_path, []string{"TIME_in_minutes", "VERTEX_INDEX"}, &errs)
+    t.check_count(&errs)
+    for j, row := range t.rows {
+        time := t.positive(row, 0, &errs)
+        vertex_index := t.int(row, 1, &errs)
+        if vertex_index < 0 || vertex_index >= len(vertex_set) {
+            errs.add(t.path, row.line, "VERTEX_INDEX: %d not in %s", vertex_index, vertex_set_path)
+        } else if vertex_set[vertex_index].vertex_type != RAIL_SWITCH {
+            errs.add(t.path, row.line, "VERTEX_INDEX: vertex %d is not a rail switch in %s", vertex_index, vertex_set_path)
+        } else if vertex_set[vertex_index].index != j {
+            errs.add(t.path, row.line, "VERTEX_INDEX: vertex %d is switch number %d in %s, this is switch number %d", vertex_index, vertex_set[vertex_index].index, vertex_set_path, j)
+        }
+        rail_switches = append(rail_switches, rail_switch{wait_time: time, is_free:new_sim_semaphore(1), rotating:new_sim_channel(), rotate_done:new_sim_channel(), vertex_index:vertex_index})
+    }
+    if len(rail_switches) != switches_count {
+        errs.add(t.path, 0, "%d rail switches but %s has %d switch vertices", len(rail_switches), vertex_set_path, switches_count)
+    }
+
+   //Get trains
+    t = read_table(trains_path, []string{"NAME", "CAPACITY", "SPEED", "PATH", "LINE?", "SERVICE?", "TURNAROUND?"}, &errs)
+    t.check_count(&errs)
+    for _, row := range t.rows {
+        name := t.text(row, 0)
+        capacity := t.int(row, 1, &errs)
+        speed := t.positive(row, 2, &errs)
+        path_string := strings.Split(t.text(row, 3), "-")
+        path_int := make([]int, len(path_string))
+        path_ok := len(path_string) >= 2
+        if !path_ok {
+            errs.add(t.path, row.line, "PATH: train needs at least two vertices")
+        }
+        for k:=0; k<len(path_string);k++{
+            v, err := strconv.Atoi(path_string[k])
+            if err != nil {
+                errs.add(t.path, row.line, "PATH: bad vertex %q", path_string[k])
+                path_ok = false
+            } else if v < 0 || v >= n {
+                errs.add(t.path, row.line, "PATH: unknown vertex %d", v)
+                path_ok = false
+            }
+            path_int[k] = v
+        }
+        if capacity < 0 {
+            errs.add(t.path, row.line, "CAPACITY: must not be negative")
+        }
+        line := t.text(row, 4)
+        if line == "" {
+            line = name
+        }
+        train_unit := train{name:name, line: line, service: SERVICE_CIRCULAR, capacity:capacity,speed:speed, path: path_int, current_strech:make([]int, 2), repaired:new_sim_channel(), released:new_sim_channel()}
+        if service := t.text(row, 5); service != "" {
+            train_unit.service = service
+        }
+        if turnaround := t.text(row, 6); turnaround != "" {
+            var err error
+            if train_unit.turnaround, err = strconv.ParseFloat(turnaround, 64); err != nil {
+                errs.add(t.path, row.line, "TURNAROUND: bad number %q", turnaround)
+            }
+        }
+        if path_ok {
+            if msg := check_service(train_unit, vertex_set, stations); msg != "" {
+                errs.add(t.path, row.line, "SERVICE: %s", msg)
+            } else if v1, v2, ok := missing_edge(train_unit, system); !ok {
+                errs.add(t.path, row.line, "PATH: uses non-existent edge %d -> %d%s", v1, v2, back_edge_hint(train_unit, v1, v2))
+            }
+        }
+        trains = append(trains, train_unit)
+    }
+
+    return system, stations, trains, vertex_set, rail_switches, errs
+}
+
+
+/* Scenario file */
+
+//everything loaded from input data
+type input_data struct {
+    system          [][]railway
+    stations        []station
+    trains          []train
+    vertex_set      []vertex
+    rail_switches   []rail_switch
+    depot           *scenario_depot //nil if data does not set it
+    fleet           []fleet_depot   //empty if data does not set it
+    failures        *scenario_failures //nil if data does not set it
+    incidents       []scenario_incident //incident script, resolved by resolve_script
+    timetable       []scenario_stop //resolved into timetables of trains
+    demand          *demand //nil if data has no passenger demand
+}
+
+//single JSON document describing the whole network,
+//vertices are referenced by name instead of line order
+type scenario_file struct {
+    Vertices    []scenario_vertex   `json:"vertices"`
+    Edges       []scenario_edge     `json:"edges"`
+    Stations    []scenario_station  `json:"stations"`
+    Switches    []scenario_switch   `json:"switches"`
+    Trains      []scenario_train    `json:"trains"`
+    RepairDepot *scenario_depot     `json:"repair_depot,omitempty"`
+    Fleet       []scenario_fleet    `json:"fleet,omitempty"` //replaces repair_depot vertex
+    Failures    *scenario_failures  `json:"failures,omitempty"`
+    Incidents   []scenario_incident `json:"incidents,omitempty"`
+    Demand      *scenario_demand    `json:"demand,omitempty"`
+    Timetable   []scenario_stop     `json:"timetable,omitempty"`
+}
+
+type scenario_vertex struct {
+    Name    string  `json:"name"`
+    Type    string  `json:"type"` //"station" or "switch"
+}
+
+type scenario_edge struct {
+    From        string  `json:"from"`
+    To          string  `json:"to"`
+    MaxSpeed    float64 `json:"max_speed"` //kmh
+    Length      float64 `json:"length"`    //km
+    Repair      string  `json:"repair,omitempty"` //repair time distribution of this railway
+    Failure     string  `json:"failure,omitempty"` //failure model of this railway
+}
+
+type scenario_station struct {
+    Vertex          string  `json:"vertex"`
+    Platforms       int     `json:"platforms"`
+    Depots          int     `json:"depots"`
+    WaitTimeMinutes float64 `json:"wait_time_minutes"`
+}
+
+type scenario_switch struct {
+    Vertex          string  `json:"vertex"`
+    RotationMinutes float64 `json:"rotation_minutes"`
+    Repair          string  `json:"repair,omitempty"`
+    Failure         string  `json:"failure,omitempty"`
+}
+
+type scenario_train struct {
+    Name        string      `json:"name"`
+    Capacity    int         `json:"capacity"`
+    Speed       float64     `json:"speed"` //kmh
+    Path        []string    `json:"path"`
+    Line        string      `json:"line,omitempty"` //name of train if empty
+    Service     string      `json:"service,omitempty"` //circular, shuttle or one-shot, circular if empty
+    TurnaroundMinutes float64 `json:"turnaround_minutes,omitempty"` //shuttle, wait time of station if 0
+    Repair      string      `json:"repair,omitempty"`
+    Failure     string      `json:"failure,omitempty"`
+}
+
+type scenario_fleet struct {
+    Vertex      string  `json:"vertex"`
+    Vehicles    int     `json:"vehicles"`
+}
+
+//failure models of every asset of a type
+type scenario_failures struct {
+    Railway     string  `json:"railway,omitempty"`
+    RailSwitch  string  `json:"rail_switch,omitempty"`
+    Train       string  `json:"train,omitempty"`
+    railway     *failure_model
+    rail_switch *failure_model
+    train       *failure_model
+}
+
+//passenger demand between stations, profiles add to the built-in flat and commuter
+type scenario_demand struct {
+    Profiles    []scenario_profile  `json:"profiles,omitempty"`
+    OD          []scenario_od       `json:"od"`
+}
+
+type scenario_profile struct {
+    Name    string  `json:"name"`
+    Hours   string  `json:"hours"` //"7" or "7-9"
+    Factor  float64 `json:"factor"`
+}
+
+type scenario_od struct {
+    From    string  `json:"from"`
+    To      string  `json:"to"`
+    PerHour float64 `json:"per_hour"`
+    Profile string  `json:"profile,omitempty"` //flat if empty
+}
+
+type scenario_depot struct {
+    Vertex                  string  `json:"vertex"`
+    Speed                   float64 `json:"speed,omitempty"` //kmh of repair vehicle
+    RailSwitchRepairHours   float64 `json:"rail_switch_repair_hours,omitempty"`
+    RailwayRepairHours      float64 `json:"railway_repair_hours,omitempty"`
+    TrainRepairHours        float64 `json:"train_repair_hours,omitempty"`
+    PlatformRepairHours     float64 `json:"platform_repair_hours,omitempty"`
+    RailSwitchRepair        string  `json:"rail_switch_repair,omitempty"` //distribution, replaces hours
+    RailwayRepair           string  `json:"railway_repair,omitempty"`
+    TrainRepair             string  `json:"train_repair,omitempty"`
+    PlatformRepair          string  `json:"platform_repair,omitempty"`
+    vertex_index            int
+    rail_switch_repair      *distribution //parsed from hours or distribution, nil if not set
+    railway_repair          *distribution
+    train_repair            *distribution
+    platform_repair         *distribution
+}
+
+//Get all data from scenario file, every problem is reported in errs
+func load_scenario(path string) (input_data, input_errors) {
+    var data input_data
+    var doc scenario_file
+    var errs input_errors
+
+    content, err := ioutil.ReadFile(path)
+    if err != nil {
+        errs.add(path, 0, "%v", err)
+        return data, errs
+    }
+    decoder := json.NewDecoder(bytes.NewReader(content))
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&doc); err != nil {
+        line := 0
+        switch e := err.(type) {
+            case *json.SyntaxError:
+                line = line_of_offset(content, e.Offset)
+            case *json.UnmarshalTypeError:
+                line = line_of_offset(content, e.Offset)
+        }
+        errs.add(path, line, "%v", err)
+        return data, errs
+    }
+
+    lines := index_json(content)
+    //report problem of value at JSON path, with line of the value or of its entry
+    fail := func(at string, format string, args ...interface{}) {
+        errs.add(path, lines.line(at), "%s: %s", at, fmt.Sprintf(format, args...))
+    }
+
+    //vertices, stations and switches are indexed in order of vertices list
+    vertex_index := map[string]int{}
+    station_at := map[string]int{}
+    switch_at := map[string]int{}
+    for k, st := range doc.Stations {
+        at := fmt.Sprintf("stations[%d]", k)
+        if _, ok := station_at[st.Vertex]; ok {
+            fail(at+".vertex", "station %q defined twice", st.Vertex)
+        }
+        if st.Platforms < 1 {
+            fail(at+".platforms", "station %q needs at least one platform", st.Vertex)
+        }
+        if st.Depots < 0 {
+            fail(at+".depots", "station %q has negative depots", st.Vertex)
+        }
+        if st.WaitTimeMinutes < 0 {
+            fail(at+".wait_time_minutes", "station %q has negative wait time", st.Vertex)
+        }
+        station_at[st.Vertex] = k
+    }
+    for k, sw := range doc.Switches {
+        at := fmt.Sprintf("switches[%d]", k)
+        if _, ok := switch_at[sw.Vertex]; ok {
+            fail(at+".vertex", "switch %q defined twice", sw.Vertex)
+        }
+        if sw.RotationMinutes <= 0 {
+            fail(at+".rotation_minutes", "switch %q rotation_minutes must be greater than 0", sw.Vertex)
+        }
+        switch_at[sw.Vertex] = k
+    }
+
+    //optional repair time, empty text uses the one of settings
+    repair := func(text string, at string) *distribution {
+        if text == "" {
+            return nil
+        }
+        d, err := parse_distribution(text)
+        if err != nil {
+            fail(at, "%v", err)
+            return nil
+        }
+        return &d
+    }
+    //optional failure model, empty text uses the one of settings
+    failure := func(text string, unit string, at string) *failure_model {
+        if text == "" {
+            return nil
+        }
+        m, err := parse_failure_model(text, unit)
+        if err != nil {
+            fail(at, "%v", err)
+            return nil
+        }
+        return &m
+    }
+
+    data.vertex_set = make([]vertex, len(doc.Vertices))
+    for i, v := range doc.Vertices {
+        at := fmt.Sprintf("vertices[%d]", i)
+        if _, ok := vertex_index[v.Name]; ok {
+            fail(at+".name", "vertex %q defined twice", v.Name)
+        }
+        vertex_index[v.Name] = i
+
+        switch v.Type {
+            case "station":
+                st := scenario_station{Platforms: 1}
+                if k, ok := station_at[v.Name]; ok {
+                    st = doc.Stations[k]
+                } else {
+                    fail(at, "station vertex %q has no station entry", v.Name)
+                }
+                data.vertex_set[i] = vertex{vertex_type: STATION, index: len(data.stations)}
+                data.stations = append(data.stations, station{name: v.Name, free_platforms: new_sim_semaphore(st.Platforms), free_depots: new_sim_semaphore(st.Depots), wait_time: st.WaitTimeMinutes, vertex_index: i, platforms: st.Platforms})
+            case "switch":
+                var sw scenario_switch
+                sw_at := ""
+                if k, ok := switch_at[v.Name]; ok {
+                    sw, sw_at = doc.Switches[k], fmt.Sprintf("switches[%d]", k)
+                } else {
+                    fail(at, "switch vertex %q has no switch entry", v.Name)
+                }
+                data.vertex_set[i] = vertex{vertex_type: RAIL_SWITCH, index: len(data.rail_switches)}
+                data.rail_switches = append(data.rail_switches, rail_switch{name: v.Name, wait_time: sw.RotationMinutes, is_free: new_sim_semaphore(1), rotating: new_sim_channel(), rotate_done: new_sim_channel(), vertex_index: i, repair: repair(sw.Repair, sw_at+".repair"), health: asset_health{failure: failure(sw.Failure, USAGE_ROTATIONS, sw_at+".failure")}})
+            default:
+                fail(at+".type", "vertex %q has unknown type %q, must be station or switch", v.Name, v.Type)
+                data.vertex_set[i] = vertex{vertex_type: STATION, index: -1}
+        }
+    }
+
+    lookup := func(name string, at string) (int, bool) {
+        v, ok := vertex_index[name]
+        if !ok {
+            fail(at, "unknown vertex %q", name)
+        }
+        return v, ok
+    }
+    for k, st := range doc.Stations {
+        at := fmt.Sprintf("stations[%d].vertex", k)
+        if v, ok := lookup(st.Vertex, at); ok && doc.Vertices[v].Type != "station" {
+            fail(at, "vertex %q is not a station", st.Vertex)
+        }
+    }
+    for k, sw := range doc.Switches {
+        at := fmt.Sprintf("switches[%d].vertex", k)
+        if v, ok := lookup(sw.Vertex, at); ok && doc.Vertices[v].Type != "switch" {
+            fail(at, "vertex %q is not a switch", sw.Vertex)
+        }
+    }
+
+    n := len(doc.Vertices)
+    data.system = make([][]railway, n)
+    for i:=0; i<n; i++ {
+        data.system[i] = make([]railway, n)
+    }
+    for k, e := range doc.Edges {
+        at := fmt.Sprintf("edges[%d]", k)
+        v1, ok1 := lookup(e.From, at+".from")
+        v2, ok2 := lookup(e.To, at+".to")
+        if e.MaxSpeed <= 0 {
+            fail(at+".max_speed", "must be greater than 0")
+        }
+        if e.Length <= 0 {
+            fail(at+".length", "must be greater than 0")
+        }
+        if !ok1 || !ok2 {
+            continue
+        }
+        if data.system[v1][v2].is_free != nil {
+            fail(at, "edge %q -> %q defined twice", e.From, e.To)
+        }
+        data.system[v1][v2] = railway{max_speed: e.MaxSpeed, length: e.Length, is_free: new_sim_semaphore(1), repair: repair(e.Repair, at+".repair"), health: asset_health{failure: failure(e.Failure, USAGE_KM, at+".failure")}}
+    }
+
+    for k, t := range doc.Trains {
+        at := fmt.Sprintf("trains[%d]", k)
+        path_int := make([]int, len(t.Path))
+        path_ok := len(t.Path) >= 2
+        if !path_ok {
+            fail(at+".path", "train %s needs at least two vertices", t.Name)
+        }
+        for i, name := range t.Path {
+            v, ok := lookup(name, fmt.Sprintf("%s.path[%d]", at, i))
+            path_int[i] = v
+            path_ok = path_ok && ok
+        }
+        if t.Speed <= 0 {
+            fail(at+".speed", "train %s speed must be greater than 0", t.Name)
+        }
+        if t.Capacity < 0 {
+            fail(at+".capacity", "train %s capacity must not be negative", t.Name)
+        }
+        line, service := t.Line, t.Service
+        if line == "" {
+            line = t.Name
+        }
+        if service == "" {
+            service = SERVICE_CIRCULAR
+        }
+        train_unit := train{name: t.Name, line: line, service: service, turnaround: t.TurnaroundMinutes, capacity: t.Capacity, speed: t.Speed, path: path_int, current_strech: make([]int, 2), repaired: new_sim_channel(), released: new_sim_channel(), repair: repair(t.Repair, at+".repair"), health: asset_health{failure: failure(t.Failure, USAGE_KM, at+".failure")}}
+        if path_ok {
+            if msg := check_service(train_unit, data.vertex_set, data.stations); msg != "" {
+                fail(at+".service", "train %s: %s", t.Name, msg)
+            } else if v1, v2, ok := missing_edge(train_unit, data.system); !ok {
+                fail(at+".path", "train %s uses non-existent edge %q -> %q%s", t.Name, doc.Vertices[v1].Name, doc.Vertices[v2].Name, back_edge_hint(train_unit, v1, v2))
+            }
+        }
+        data.trains = append(data.trains, train_unit)
+    }
+
+    if depot := doc.RepairDepot; depot != nil {
+        depot.vertex_index, _ = lookup(depot.Vertex, "repair_depot.vertex")
+        //distribution wins over hours
+        hours := func(h float64, text string, what string) *distribution {
+            if text != "" {
+                return repair(text, "repair_depot."+what)
+            }
+            if h < 0 {
+                fail("repair_depot."+what+"_hours", "must not be negative")
+            }
+            if h <= 0 {
+                return nil
+            }
+            d := fixed_distribution(time.Duration(h * float64(time.Hour)))
+            return &d
+        }
+        depot.rail_switch_repair = hours(depot.RailSwitchRepairHours, depot.RailSwitchRepair, "rail_switch_repair")
+        depot.railway_repair = hours(depot.RailwayRepairHours, depot.RailwayRepair, "railway_repair")
+        depot.train_repair = hours(depot.TrainRepairHours, depot.TrainRepair, "train_repair")
+        depot.platform_repair = hours(depot.PlatformRepairHours, depot.PlatformRepair, "platform_repair")
+        data.depot = depot
+    }
+    if f := doc.Failures; f != nil {
+        f.railway = failure(f.Railway, USAGE_KM, "failures.railway")
+        f.rail_switch = failure(f.RailSwitch, USAGE_ROTATIONS, "failures.rail_switch")
+        f.train = failure(f.Train, USAGE_KM, "failures.train")
+        data.failures = f
+    }
+    data.incidents = doc.Incidents
+    for k := range data.incidents {
+        data.incidents[k].at = fmt.Sprintf("incidents[%d]", k)
+        data.incidents[k].line = lines.line(data.incidents[k].at)
+    }
+    if len(errs) == 0 {
+        data.timetable = doc.Timetable
+        for k := range data.timetable {
+            data.timetable[k].at = fmt.Sprintf("timetable[%d]", k)
+            data.timetable[k].line = lines.line(data.timetable[k].at)
+        }
+        errs = append(errs, resolve_timetable(path, doc.Timetable, data)...)
+    }
+    if doc.Demand != nil {
+        d := new_demand()
+        for k, p := range doc.Demand.Profiles {
+            at := fmt.Sprintf("demand.profiles[%d]", k)
+            from, to, err := parse_hours(p.Hours)
+            switch {
+                case builtin_profile(p.Name):
+                    fail(at+".name", "profile %s is built in and can not be changed", p.Name)
+                case err != nil:
+                    fail(at+".hours", "%v", err)
+                case p.Factor < 0:
+                    fail(at+".factor", "must not be negative")
+                default:
+                    d.set_profile(p.Name, from, to, p.Factor)
+            }
+        }
+        for k, od := range doc.Demand.OD {
+            at := fmt.Sprintf("demand.od[%d]", k)
+            f := flow{per_hour: od.PerHour, profile: od.Profile}
+            if f.profile == "" {
+                f.profile = PROFILE_FLAT
+            }
+            if od.PerHour <= 0 {
+                fail(at+".per_hour", "must be greater than 0")
+            }
+            if msg := d.check_flow(&f, od.From, od.To, data); msg != "" {
+                fail(at, "%s", msg)
+                continue
+            }
+            d.flows = append(d.flows, f)
+        }
+        data.demand = d
+    }
+    for k, f := range doc.Fleet {
+        at := fmt.Sprintf("fleet[%d]", k)
+        v, ok := lookup(f.Vertex, at+".vertex")
+        if f.Vehicles < 1 {
+            fail(at+".vehicles", "must be at least 1")
+        }
+        if ok {
+            data.fleet = append(data.fleet, fleet_depot{vertex: v, vehicles: f.Vehicles})
+        }
+    }
+
+    return data, errs
+}
+
+//line number of byte offset in file content
+func line_of_offset(content []byte, offset int64) int {
+    if offset > int64(len(content)) {
+        offset = int64(len(content))
+    }
+    return bytes.Count(content[:offset], []byte("\n")) + 1
+}
+
+//line of every value of JSON document by its path like trains[2].path[3]
+type json_lines map[string]int
+
+//index values of valid JSON document, root value has the empty path
+func index_json(content []byte) json_lines {
+    lines := json_lines{}
+    decoder := json.NewDecoder(bytes.NewReader(content))
+    var value func(at string) bool
+    value = func(at string) bool {
+        token, err := decoder.Token()
+        if err != nil {
+            return false
+        }
+        //offset is just behind token, which never spans lines
+        lines[at] = line_of_offset(content, decoder.InputOffset())
+        switch token {
+            case json.Delim('{'):
+                for decoder.More() {
+                    key, err := decoder.Token()
+                    if err != nil {
+                        return false
+                    }
+                    name := key.(string)
+                    if at != "" {
+                        name = at + "." + name
+                    }
+                    if !value(name) {
+                        return false
+                    }
+                }
+            case json.Delim('['):
+                for k := 0; decoder.More(); k++ {
+                    if !value(fmt.Sprintf("%s[%d]", at, k)) {
+                        return false
+                    }
+                }
+            default:
+                return true
+        }
+        _, err = decoder.Token() //closing delimiter
+        return err == nil
+    }
+    value("")
+    return lines
+}
+
+//line of value at path, of the entry holding it if the value is left out
+func (lines json_lines) line(at string) int {
+    for at != "" {
+        if line, ok := lines[at]; ok {
+            return line
+        }
+        i := strings.LastIndexAny(at, ".[")
+        if i < 0 {
+            i = 0
+        }
+        at = at[:i]
+    }
+    return 0
+}
+
+//text of own repair time of asset, empty if it has none
+func repair_text(d *distribution) string {
+    if d == nil {
+        return ""
+    }
+    return d.text
+}
+
+//text of own failure model of asset, empty if it has none
+func failure_text(m *failure_model) string {
+    if m == nil {
+        return ""
+    }
+    return m.text
+}
+
+//write input data as scenario file, repair depot is taken from settings
+func export_scenario(out *os.File, data input_data, cfg config) error {
+    var doc scenario_file
+    name := func(v int) string {
+        return vertex_name(v, data.stations, data.vertex_set, data.rail_switches)
+    }
+
+    for v:=0; v<len(data.vertex_set); v++ {
+        if data.vertex_set[v].vertex_type == RAIL_SWITCH {
+            doc.Vertices = append(doc.Vertices, scenario_vertex{Name: name(v), Type: "switch"})
+            sw := data.rail_switches[data.vertex_set[v].index]
+            doc.Switches = append(doc.Switches, scenario_switch{Vertex: name(v), RotationMinutes: sw.wait_time, Repair: repair_text(sw.repair), Failure: failure_text(sw.health.failure)})
+        } else {
+            doc.Vertices = append(doc.Vertices, scenario_vertex{Name: name(v), Type: "station"})
+            st := data.stations[data.vertex_set[v].index]
+            doc.Stations = append(doc.Stations, scenario_station{Vertex: name(v), Platforms: st.platforms, Depots: st.free_depots.free, WaitTimeMinutes: st.wait_time})
+        }
+    }
+
+    for v1:=0; v1<len(data.system); v1++ {
+        for v2:=0; v2<len(data.system); v2++ {
+            if data.system[v1][v2].is_free != nil {
+                doc.Edges = append(doc.Edges, scenario_edge{From: name(v1), To: name(v2), MaxSpeed: data.system[v1][v2].max_speed, Length: data.system[v1][v2].length, Repair: repair_text(data.system[v1][v2].repair), Failure: failure_text(data.system[v1][v2].health.failure)})
+            }
+        }
+    }
+
+    for _, t := range data.trains {
+        path := make([]string, len(t.path))
+        for k, v := range t.path {
+            path[k] = name(v)
+        }
+        line := t.line
+        if line == t.name {
+            line = ""
+        }
+        service := t.service
+        if service == SERVICE_CIRCULAR {
+            service = ""
+        }
+        doc.Trains = append(doc.Trains, scenario_train{Name: t.name, Capacity: t.capacity, Speed: t.speed, Path: path, Line: line, Service: service, TurnaroundMinutes: t.turnaround, Repair: repair_text(t.repair), Failure: failure_text(t.health.failure)})
+    }
+
+    if cfg.repair_vertex < 0 || cfg.repair_vertex >= len(data.vertex_set) {
+        return fmt.Errorf("repair vertex %d out of range 0-%d", cfg.repair_vertex, len(data.vertex_set)-1)
+    }
+    doc.RepairDepot = &scenario_depot{
+        Vertex: name(cfg.repair_vertex),
+        Speed: cfg.repair_speed,
+    }
+    //fixed repair times keep the hours fields
+    if d := cfg.rail_switch_repair_time; d.kind == DIST_FIXED {
+        doc.RepairDepot.RailSwitchRepairHours = d.a.Hours()
+    } else {
+        doc.RepairDepot.RailSwitchRepair = d.text
+    }
+    if d := cfg.railway_repair_time; d.kind == DIST_FIXED {
+        doc.RepairDepot.RailwayRepairHours = d.a.Hours()
+    } else {
+        doc.RepairDepot.RailwayRepair = d.text
+    }
+    if d := cfg.train_repair_time; d.kind == DIST_FIXED {
+        doc.RepairDepot.TrainRepairHours = d.a.Hours()
+    } else {
+        doc.RepairDepot.TrainRepair = d.text
+    }
+    if d := cfg.platform_repair_time; d.kind == DIST_FIXED {
+        doc.RepairDepot.PlatformRepairHours = d.a.Hours()
+    } else {
+        doc.RepairDepot.PlatformRepair = d.text
+    }
+    //single vehicle at repair depot needs no fleet
+    if len(cfg.fleet) > 1 || (len(cfg.fleet) == 1 && (cfg.fleet[0].vehicles != 1 || cfg.fleet[0].vertex != cfg.repair_vertex)) {
+        for _, f := range cfg.fleet {
+            doc.Fleet = append(doc.Fleet, scenario_fleet{Vertex: name(f.vertex), Vehicles: f.vehicles})
+        }
+    }
+
+    if cfg.railway_failure.set() || cfg.rail_switch_failure.set() || cfg.train_failure.set() {
+        doc.Failures = &scenario_failures{Railway: cfg.railway_failure.text, RailSwitch: cfg.rail_switch_failure.text, Train: cfg.train_failure.text}
+    }
+    doc.Incidents = data.incidents
+    doc.Timetable = data.timetable
+    if d := data.demand; d != nil {
+        doc.Demand = &scenario_demand{}
+        var names []string
+        for name := range d.profiles {
+            if !builtin_profile(name) {
+                names = append(names, name)
+            }
+        }
+        sort.Strings(names)
+        //consecutive hours with same factor become one range
+        for _, name := range names {
+            profile := d.profiles[name]
+            for from:=0; from<24; {
+                to := from
+                for to+1 < 24 && profile[to+1] == profile[from] {
+                    to++
+                }
+                hours := strconv.Itoa(from)
+                if to > from {
+                    hours += "-" + strconv.Itoa(to)
+                }
+                doc.Demand.Profiles = append(doc.Demand.Profiles, scenario_profile{Name: name, Hours: hours, Factor: profile[from]})
+                from = to + 1
+            }
+        }
+        for _, f := range d.flows {
+            doc.Demand.OD = append(doc.Demand.OD, scenario_od{From: name(f.origin), To: name(f.destination), PerHour: f.per_hour, Profile: f.profile})
+        }
+    }
+
+    encoder := json.NewEncoder(out)
+    encoder.SetIndent("", "    ")
+    return encoder.Encode(doc)
+}
+
+// Dijkstra's algorithm to find shortest path from s to destin
+//usable filters edges, nil allows every edge, returns nil if destin can not be reached
+func dijkstra(G [][]railway, src int, destin int, usable func(v1 int, v2 int) bool) []int {
+    n := len(G)
+    dist := make([]int, n)
+    pred := make([]int, n)  // preceeding node in path
+    visited := make([]bool, n) // all false initially
+  
+    for i:=0; i<n; i++ {
+        dist[i] = 30000 //very big value
+    }
+    dist[src] = 0
+  
+    for i:=0; i<n; i++ {
+        next := minVertex(dist, visited)
+        if next == -1 { //rest of graph can not be reached
+            break
+        }
+        visited[next] = true
+
+        neighbors := make([]int,0)
+        for i:=0;i<n;i++{
+            if G[next][i].length > 0 && (usable == nil || usable(next, i)) {
+                neighbors = append(neighbors,i)
+            }
+        }
+
+        for j:=0; j<len(neighbors); j++ {
+            v := neighbors[j];
+            d := dist[next] + int(G[next][v].length);
+            if dist[v] > d {
+                dist[v] = d
+                pred[v] = next
+            }
+        }
+    }
+
+    if !visited[destin] {
+        return nil
+    }
+    returnPath := make([]int,0)
+    for destin != src {
+        returnPath = append([]int{destin}, returnPath...)
+        destin = pred[destin]
+    }
+    returnPath = append([]int{src},returnPath...)
+
+    return returnPath
+}
+
+//km of route
+func route_length(system [][]railway, path []int) float64 {
+    length := 0.0
+    for i:=0; i<len(path)-1; i++ {
+        length += system[path[i]][path[i+1]].length
+    }
+    return length
+}
+
+//Dijkstra helper function
+func minVertex (dist []int, v []bool) int {
+    x := 30000 //very big value
+    y := -1   // graph not connected, or no unvisited vertices
+    for  i:=0; i<len(dist); i++ {
+        if !v[i] && dist[i]<x {
+            y=i
+            x=dist[i]
+        }
+    }
+    return y
+}
+
+//reverse array
+func reverse(numbers []int) []int {
+    for i, j := 0, len(numbers)-1; i < j; i, j = i+1, j-1 {
+        numbers[i], numbers[j] = numbers[j], numbers[i]
+    }
+    return numbers
+}
+
+
+/* Event stream */
+
+//simulation event, every log line is rendered from one
+type event struct {
+    Time        time.Time   `json:"time"`
+    Type        string      `json:"type"`
+    Actor       string      `json:"actor,omitempty"`
+    Vertices    []int       `json:"vertices,omitempty"`
+    Edge        string      `json:"edge,omitempty"` //"from->to"
+    Station     string      `json:"station,omitempty"`
+    Asset       string      `json:"asset,omitempty"`  //ASSET_* of crash and repair events
+    Target      string      `json:"target,omitempty"` //crashed or repaired train
+    Incident    int         `json:"incident,omitempty"` //id of crash which event belongs to
+    Passengers  int         `json:"passengers,omitempty"` //boarded or alighted
+    Load        int         `json:"load,omitempty"`  //passengers on train afterwards
+    Queue       int         `json:"queue,omitempty"` //passengers left waiting at station
+    Late        *float64    `json:"late_minutes,omitempty"` //behind timetable at last scheduled stop, negative = early
+    scheduled   bool        //arrival or departure of event is in timetable
+    Detail      string      `json:"detail,omitempty"`
+}
+
+//event at vertex
+func vertex_event(typ string, actor string, v int) event {
+    return event{Type: typ, Actor: actor, Vertices: []int{v}}
+}
+
+//event on railway between two vertices
+func edge_event(typ string, actor string, v1 int, v2 int) event {
+    return event{Type: typ, Actor: actor, Vertices: []int{v1, v2}, Edge: strconv.Itoa(v1) + "->" + strconv.Itoa(v2)}
+}
+
+//event at station
+func station_event(typ string, actor string, v int, name string) event {
+    return event{Type: typ, Actor: actor, Vertices: []int{v}, Station: name}
+}
+
+//words separated and followed by space, like every log line
+func words(parts ...string) string {
+    output := ""
+    for i:=0; i<len(parts); i++{
+        output += parts[i] + " "
+    }
+    return output
+}
+
+//vertex of event as text
+func (e event) vertex(k int) string {
+    if k >= len(e.Vertices) {
+        return "?"
+    }
+    return strconv.Itoa(e.Vertices[k])
+}
+
+//human readable line of event
+func (e event) text() string {
+    text := e.describe()
+    if e.Incident > 0 {
+        text += words("(incident", strconv.Itoa(e.Incident) + ")")
+    }
+    if e.Late != nil && e.scheduled {
+        text += words("(" + lateness(*e.Late) + ")")
+    }
+    return text
+}
+
+func (e event) describe() string {
+    switch e.Type {
+        case EVENT_SIMULATOR_STARTED:
+            return words("Simulator started")
+        case EVENT_SIMULATOR_ENDED:
+            return words("Simulator end")
+        case EVENT_TRAIN_STARTED:
+            return words(e.Actor, "has started")
+        case EVENT_TRAIN_ENTERED_EDGE:
+            return words(e.Actor, "is now on railway", e.vertex(0), "->", e.vertex(1))
+        case EVENT_TRAIN_AT_SWITCH:
+            return words(e.Actor, "is on railway switch at vertex", e.vertex(0))
+        case EVENT_TRAIN_ARRIVED_STATION:
+            return words(e.Actor, "has arrived to station", e.Station)
+        case EVENT_TRAIN_READY:
+            return words(e.Actor, "is ready to leave the station", e.Station)
+        case EVENT_TRAIN_LEFT_STATION:
+            return words(e.Actor, "has left the station", e.Station)
+        case EVENT_TRAIN_STOPPED:
+            return words(e.Actor, "has stopped", e.Detail)
+        case EVENT_TRAIN_BROKE_DOWN:
+            if e.Edge != "" {
+                return words(e.Actor, "has broken down on railway", e.vertex(0), "->", e.vertex(1) + ",", e.Detail)
+            }
+            return words(e.Actor, "has broken down at vertex", e.vertex(0))
+        case EVENT_TRAIN_RESUMED:
+            return words(e.Actor, "has been repaired and continues")
+        case EVENT_TRAIN_HELD:
+            return words(e.Actor, "is held at station", e.Station)
+        case EVENT_TRAIN_RELEASED:
+            return words(e.Actor, "has been released at station", e.Station)
+        case EVENT_TRAIN_REVERSED:
+            return words(e.Actor, "turns around at station", e.Station)
+        case EVENT_TRAIN_FINISHED:
+            return words(e.Actor, "has ended its run in depot at station", e.Station)
+        case EVENT_PLATFORM_CLOSED:
+            return words("Platform closed at station", e.Station + ",", e.Detail)
+        case EVENT_PLATFORM_OPENED:
+            return words("Platform opened at station", e.Station + ",", e.Detail)
+        case EVENT_PASSENGERS_ALIGHTED:
+            return words(e.Actor + ":", strconv.Itoa(e.Passengers), "passengers got off at", e.Station + ", load", strconv.Itoa(e.Load))
+        case EVENT_PASSENGERS_BOARDED:
+            return words(e.Actor + ":", strconv.Itoa(e.Passengers), "passengers got on at", e.Station + ", load", strconv.Itoa(e.Load) + ",", strconv.Itoa(e.Queue), "still waiting")
+        case EVENT_CONSOLE_COMMAND:
+            return words("Console:", e.Detail)
+        case EVENT_SWITCH_ROTATED:
+            return words("Rail switch at vertex", e.vertex(0), "has rotated")
+        case EVENT_CRASH:
+            switch e.Asset {
+                case ASSET_RAILWAY:
+                    return words("Railway crashed ", e.vertex(0), "====", e.vertex(1))
+                case ASSET_TRAIN:
+                    return words("Train", e.Target, "has crashed")
+                case ASSET_PLATFORM:
+                    return words("Platform crashed at station", e.Station + ",", e.Detail)
+                default:
+                    return words("Railswitch crashed at vertex", e.vertex(0))
+            }
+        case EVENT_REPAIR_DISPATCHED:
+            switch e.Asset {
+                case ASSET_RAILWAY:
+                    return words(e.Actor, "has taken an order to repair railway", e.vertex(0), "====", e.vertex(1))
+                case ASSET_TRAIN:
+                    if e.Edge != "" {
+                        return words(e.Actor, "has taken an order to repair train", e.Target, "on railway", e.vertex(0), "->", e.vertex(1))
+                    }
+                    return words(e.Actor, "has taken an order to repair train", e.Target, "at vertex", e.vertex(0))
+                case ASSET_PLATFORM:
+                    return words(e.Actor, "has taken an order to repair platform at station", e.Station)
+                default:
+                    return words(e.Actor, "has taken an order to repair rail switch at vertex", e.vertex(0))
+            }
+        case EVENT_REPAIR_COMPLETED:
+            switch e.Asset {
+                case ASSET_RAILWAY:
+                    return words(e.Actor, "has repaired railway", e.vertex(0), "====", e.vertex(1))
+                case ASSET_TRAIN:
+                    return words(e.Actor, "has repaired the train", e.Target)
+                case ASSET_PLATFORM:
+                    return words(e.Actor, "has repaired platform at station", e.Station)
+                default:
+                    return words(e.Actor, "has repaired rail switch at vertex", e.vertex(0))
+            }
+        case EVENT_REPAIR_ASSIGNED:
+            return words(e.Target, "has been assigned the order by", e.Detail, "policy")
+        case EVENT_NO_ROUTE:
+            return words(e.Actor, "has no route free of failures from vertex", e.vertex(0), "to", e.vertex(1) + ",", e.Detail)
+        case EVENT_DEPOT_CUT_OFF:
+            return words("Repair depot at vertex", e.vertex(0), "is cut off from the network")
+        case EVENT_DEPOT_RECONNECTED:
+            return words("Repair depot at vertex", e.vertex(0), "is connected to the network again")
+        case EVENT_REPAIR_QUEUED:
+            return words("No repair vehicle is free, order waits in queue at position", e.Detail)
+        case EVENT_VEHICLE_ENTERED_EDGE:
+            return words(e.Actor, "is now on railway", e.vertex(0), "->", e.vertex(1))
+        case EVENT_VEHICLE_AT_SWITCH:
+            return words(e.Actor, "is on railway switch at vertex", e.vertex(0))
+        case EVENT_VEHICLE_AT_STATION:
+            return words(e.Actor, "is on station ", e.Station)
+        case EVENT_VEHICLE_AT_TRAIN:
+            return words(e.Actor, "has reached train", e.Target + ",", e.Detail)
+        case EVENT_VEHICLE_RETURNED:
+            return words(e.Actor, "has ended its job, returned to station at vertex", e.vertex(0))
+        case EVENT_VEHICLE_STOPPED:
+            return words(e.Actor, "has stopped", e.Detail)
+    }
+    return words(e.Detail)
+}
+
+
+/* Logging */
+
+//destination of events
+type log_sink interface {
+    write(e event)
+    close() error
+}
+
+//terminal output, quiet in silent mode
+type terminal_sink struct{}
+
+func (terminal_sink) write(e event) {
+    if !settings.silent_mode {
+        fmt.Println(e.Time.Format("2006-01-02 15:04"),"\n   ", e.text() + "\n")
+    }
+}
+
+func (terminal_sink) close() error { return nil }
+
+//create file in logs directory
+func create_log_file(name string) (*os.File, error) {
+    if err := os.MkdirAll(LOGS_DIR, 0755); err != nil {
+        return nil, err
+    }
+    return os.Create(filepath.Join(LOGS_DIR, name))
+}
+
+//buffered human readable log file
+type file_sink struct {
+    file    *os.File
+    writer  *bufio.Writer
+}
+
+func new_file_sink(name string) (*file_sink, error) {
+    file, err := create_log_file(name)
+    if err != nil {
+        return nil, err
+    }
+    return &file_sink{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+func (s *file_sink) write(e event) {
+    s.writer.WriteString(e.Time.Format("2006-01-02 15:04") + "   " + e.text() + "\n")
+}
+
+func (s *file_sink) close() error {
+    if err := s.writer.Flush(); err != nil {
+        s.file.Close()
+        return err
+    }
+    return s.file.Close()
+}
+
+//buffered JSON lines file, one event per line
+type json_sink struct {
+    file_sink
+    encoder *json.Encoder
+}
+
+func new_json_sink(name string) (*json_sink, error) {
+    f, err := new_file_sink(name)
+    if err != nil {
+        return nil, err
+    }
+    encoder := json.NewEncoder(f.writer)
+    encoder.SetEscapeHTML(false)
+    return &json_sink{file_sink: *f, encoder: encoder}, nil
+}
+
+func (s *json_sink) write(e event) {
+    s.encoder.Encode(e)
+}
+
+//sends events stamped with simulator time to every sink
+type logger struct {
+    sinks   []log_sink
+    own     log_sink //file opened by this logger, closed by close
+}
+
+func new_logger(sinks ...log_sink) *logger {
+    return &logger{sinks: sinks}
+}
+
+//logger writing to the same sinks plus its own log file
+func (l *logger) open(name string) *logger {
+    child := &logger{sinks: append([]log_sink{}, l.sinks...)}
+    file, err := new_file_sink(name)
+    if err != nil {
+        l.log("Cannot create log file", name, ":", err.Error())
+        return child
+    }
+    child.sinks = append(child.sinks, file)
+    child.own = file
+    return child
+}
+
+//display event on terminal and save it to files
+func (l *logger) emit(e event) {
+    e.Time = get_current_simulator_time()
+    for _, sink := range l.sinks {
+        sink.write(e)
+    }
+}
+
+//free text message
+func (l *logger) log(line ... string) {
+    l.emit(event{Type: EVENT_MESSAGE, Detail: strings.Join(line, " ")})
+}
+
+//flush and close own log file
+func (l *logger) close() error {
+    if l.own == nil {
+        return nil
+    }
+    return l.own.close()
+}
+
+
+//thread for every rail switch
+func start_rail_switch(ctx context.Context, switch_unit *rail_switch) {
+    for {
+            //wait until some train ask for rotating
+            if _, err := switch_unit.rotating.receive(ctx); err != nil {
+                return
+            }
+            if scheduler.sleep(ctx, time.Duration(switch_unit.wait_time * float64(time.Minute))) != nil {
+                return
+            }
+            switch_unit.health.use(1)
+            sim_log.emit(vertex_event(EVENT_SWITCH_ROTATED, "Rail switch "+strconv.Itoa(switch_unit.vertex_index), switch_unit.vertex_index))
+            //rotate done, give train permission to continue
+            switch_unit.rotate_done.send(true)
+    }
+}
+
+
+//try to broke something sometimes
+//all random decisions are drawn from rng so runs with the same seed are identical
+func crash(ctx context.Context, rng *rand.Rand, fleet *dispatcher, trains []train, system [][]railway, rail_switches []rail_switch) {
+    per_asset := failure_models_set(trains, system, rail_switches)
+    step := CRASH_INTERVAL_MIN * time.Minute
+    railways := 0
+    for v1 := range system {
+        for v2 := range system[v1] {
+            if system[v1][v2].is_free != nil {
+                railways++
+            }
+        }
+    }
+    for {
+        if scheduler.sleep(ctx, step) != nil {
+            return
+        }
+
+        //up to max_open_incidents incidents can be open at once, broken assets are not chosen again
+        if per_asset {
+            crash_by_model(ctx, rng, fleet, step)
+        } else if rng.Float64() < settings.crash_rate && !incidents_full() {
+            //kind of asset the network has none of is skipped
+            choice := rng.Intn(3)
+            switch choice {
+                case 0: //crash railway
+                    if railways == 0 {
+                        break
+                    }
+                    v1 := rng.Intn(len(system))
+                    v2 := rng.Intn(len(system))
+                    for system[v1][v2].is_free == nil {
+                        v1 = rng.Intn(len(system))
+                        v2 = rng.Intn(len(system))
+                    }
+                    fail_railway(ctx, rng, fleet, "Crash", v1, v2, 0)
+
+                case 1: //crash train
+                    if len(trains) > 0 {
+                        fail_train(rng, fleet, "Crash", rng.Intn(len(trains)), 0)
+                    }
+
+                case 2: //crash switch
+                    if len(rail_switches) > 0 {
+                        fail_switch(ctx, rng, fleet, "Crash", rng.Intn(len(rail_switches)), 0)
+                    }
+            }
+        }
+    }
+}
+
+//true if random crashes have to wait until an open incident is repaired
+func incidents_full() bool {
+    return settings.max_open_incidents > 0 && stats.open_incidents() >= settings.max_open_incidents
+}
+
+//true if any asset has a failure model, then crash_rate is not used
+func failure_models_set(trains []train, system [][]railway, rail_switches []rail_switch) bool {
+    if settings.railway_failure.set() || settings.rail_switch_failure.set() || settings.train_failure.set() {
+        return true
+    }
+    for v1:=0; v1<len(system); v1++ {
+        for v2:=0; v2<len(system); v2++ {
+            if system[v1][v2].health.failure != nil {
+                return true
+            }
+        }
+    }
+    for k := range rail_switches {
+        if rail_switches[k].health.failure != nil {
+            return true
+        }
+    }
+    for k := range trains {
+        if trains[k].health.failure != nil {
+            return true
+        }
+    }
+    return false
+}
+
+//roll failure of every working asset for the last step of simulated time
+func crash_by_model(ctx context.Context, rng *rand.Rand, fleet *dispatcher, step time.Duration) {
+    fails := func(h *asset_health, model failure_model, broken bool) bool {
+        used := h.usage - h.checked
+        h.checked = h.usage
+        if h.failure != nil {
+            model = *h.failure
+        }
+        if broken || !model.set() || incidents_full() {
+            return false
+        }
+        age1 := scheduler.now - h.since
+        age0 := age1 - step
+        if age0 < 0 {
+            age0 = 0
+        }
+        return rng.Float64() < model.chance(age0, age1, used)
+    }
+
+    system := fleet.system
+    for v1:=0; v1<len(system); v1++ {
+        for v2:=0; v2<len(system); v2++ {
+            if system[v1][v2].is_free == nil {
+                continue
+            }
+            if fails(&system[v1][v2].health, settings.railway_failure, system[v1][v2].incident != 0) {
+                fail_railway(ctx, rng, fleet, "Crash", v1, v2, 0)
+            }
+        }
+    }
+    for k := range fleet.rail_switches {
+        if fails(&fleet.rail_switches[k].health, settings.rail_switch_failure, fleet.rail_switches[k].incident != 0) {
+            fail_switch(ctx, rng, fleet, "Crash", k, 0)
+        }
+    }
+    for k := range fleet.trains {
+        if fails(&fleet.trains[k].health, settings.train_failure, fleet.trains[k].broken) {
+            fail_train(rng, fleet, "Crash", k, 0)
+        }
+    }
+}
+
+//send order to fleet, repair time 0 is drawn from distribution of asset
+func order_repair(rng *rand.Rand, fleet *dispatcher, order repair_order, repair_time time.Duration) {
+    if repair_time <= 0 {
+        repair_time = fleet.repair_distribution(order).draw(rng)
+    }
+    order.repair_time = repair_time
+    fleet.dispatch(order)
+}
+
+//take token of failed asset as soon as the train using it leaves, caller does not wait for that,
+//returned func gives token back after repair, or stops waiting for it if repair came first
+func out_of_service(ctx context.Context, actor string, t *sim_semaphore) func() {
+    taken, repaired := false, false
+    taker := scheduler.spawn(actor, func() {
+        if repaired {
+            return
+        }
+        if ok, err := t.seize(ctx); !ok || err != nil {
+            return
+        }
+        if repaired { //token was handed over at the moment of repair
+            t.release()
+            return
+        }
+        taken = true
+    })
+    taker.background = true
+    return func() {
+        repaired = true
+        if taken {
+            t.release_holder(taker)
+        } else {
+            scheduler.interrupt(taker)
+        }
+    }
+}
+
+//break railway v1 -> v2, false if it is broken already, actor is reported as cause
+func fail_railway(ctx context.Context, rng *rand.Rand, fleet *dispatcher, actor string, v1 int, v2 int, repair_time time.Duration) bool {
+    rail := &fleet.system[v1][v2]
+    if rail.incident != 0 {
+        return false
+    }
+    id := count_crash(ASSET_RAILWAY)
+    rail.incident = id
+    e := edge_event(EVENT_CRASH, actor, v1, v2)
+    e.Asset = ASSET_RAILWAY
+    e.Incident = id
+    e.Detail = rail.health.fail(id, USAGE_KM)
+    sim_log.emit(e)
+    //dont allow to use railway by other trains, one on it already may leave it
+    restore := out_of_service(ctx, actor, rail.is_free)
+    //send information to repair vehicle about crashed railway
+    order_repair(rng, fleet, repair_order{incident: id, repair_type: RAILWAY_REPAIR, vertex1: v1, vertex2: v2, restore: restore}, repair_time)
+    return true
+}
+
+//break train of index, false if it is broken already
+func fail_train(rng *rand.Rand, fleet *dispatcher, actor string, indx int, repair_time time.Duration) bool {
+    train_unit := &fleet.trains[indx]
+    if train_unit.broken || train_unit.finished {
+        return false
+    }
+    id := count_crash(ASSET_TRAIN)
+    train_unit.broken = true
+    train_unit.incident = id
+    sim_log.emit(event{Type: EVENT_CRASH, Actor: actor, Asset: ASSET_TRAIN, Target: train_unit.name, Incident: id, Detail: train_unit.health.fail(id, USAGE_KM)})
+    //halt train if it is on railway now, otherwise it stops at next vertex
+    scheduler.interrupt(train_unit.actor)
+    order_repair(rng, fleet, repair_order{incident: id, repair_type: TRAIN_REPAIR, index: indx}, repair_time)
+    return true
+}
+
+//break rail switch of index in rail_switches, false if it is broken already
+func fail_switch(ctx context.Context, rng *rand.Rand, fleet *dispatcher, actor string, indx int, repair_time time.Duration) bool {
+    switch_unit := &fleet.rail_switches[indx]
+    if switch_unit.incident != 0 {
+        return false
+    }
+    id := count_crash(ASSET_RAIL_SWITCH)
+    switch_unit.incident = id
+    e := vertex_event(EVENT_CRASH, actor, switch_unit.vertex_index)
+    e.Asset = ASSET_RAIL_SWITCH
+    e.Incident = id
+    e.Detail = switch_unit.health.fail(id, USAGE_ROTATIONS)
+    sim_log.emit(e)
+    //dont allow to use rail switch by other trains, one on it already may leave it
+    restore := out_of_service(ctx, actor, switch_unit.is_free)
+    order_repair(rng, fleet, repair_order{incident: id, repair_type: RAIL_SWITCH_REPAIR, index: switch_unit.vertex_index, restore: restore}, repair_time)
+    return true
+}
+
+//take one platform of station of index in stations out of service,
+//false if every platform is out of service already
+func fail_platform(ctx context.Context, rng *rand.Rand, fleet *dispatcher, actor string, indx int, repair_time time.Duration) bool {
+    station_unit := &fleet.stations[indx]
+    if station_unit.closed_platforms == station_unit.platforms {
+        return false
+    }
+    id := count_crash(ASSET_PLATFORM)
+    station_unit.closed_platforms++
+    e := station_event(EVENT_CRASH, actor, station_unit.vertex_index, station_unit.name)
+    e.Asset = ASSET_PLATFORM
+    e.Incident = id
+    e.Detail = fmt.Sprintf("%d of %d platforms out of service", station_unit.closed_platforms, station_unit.platforms)
+    sim_log.emit(e)
+    //platform is taken as soon as no train stands at it
+    restore := out_of_service(ctx, actor, station_unit.free_platforms)
+    order_repair(rng, fleet, repair_order{incident: id, repair_type: PLATFORM_REPAIR, index: station_unit.vertex_index, restore: restore}, repair_time)
+    return true
+}
+
+/* Incident script */
+
+//fault of incident script, vertices and trains are referenced by name or number
+type scenario_incident struct {
+    At      string  `json:"at"`    //"14:30" on first day it comes after start, "2017-01-01 14:30" or time since start like "26h30m"
+    Asset   string  `json:"asset"` //railway, rail_switch, platform or train
+    From    string  `json:"from,omitempty"` //railway
+    To      string  `json:"to,omitempty"`
+    Vertex  string  `json:"vertex,omitempty"` //rail switch, or station of platform
+    Train   string  `json:"train,omitempty"`
+    Repair  string  `json:"repair,omitempty"` //fixed repair time, default is drawn like for crashes
+    at      string  //JSON path of incident, empty for console
+    line    int     //of incident in file, 0 for console
+}
+
+//incident of script with indexes instead of names
+type scripted_incident struct {
+    at          time.Duration //since start of simulation
+    asset       string        //ASSET_*
+    index       int           //train, rail switch or station index
+    vertex1     int           //railway
+    vertex2     int
+    repair_time time.Duration //0 = drawn from distribution of asset
+}
+
+//incidents of -incidents file or else of scenario file, file is where they come from
+func read_script(cfg config, data input_data) ([]scenario_incident, string, input_errors) {
+    var raw []scenario_incident
+    var errs input_errors
+    if cfg.incidents_file == "" {
+        return data.incidents, cfg.data_dir, errs
+    }
+
+    path := cfg.incidents_file
+    content, err := ioutil.ReadFile(path)
+    if err != nil {
+        errs.add(path, 0, "%v", err)
+        return raw, path, errs
+    }
+    decoder := json.NewDecoder(bytes.NewReader(content))
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&raw); err != nil {
+        line := 0
+        switch e := err.(type) {
+            case *json.SyntaxError:
+                line = line_of_offset(content, e.Offset)
+            case *json.UnmarshalTypeError:
+                line = line_of_offset(content, e.Offset)
+        }
+        errs.add(path, line, "%v", err)
+        return raw, path, errs
+    }
+    lines := index_json(content)
+    for k := range raw {
+        raw[k].at = fmt.Sprintf("[%d]", k)
+        raw[k].line = lines.line(raw[k].at)
+    }
+    return raw, path, errs
+}
+
+//check incidents of script and find their assets, script is sorted by time
+func resolve_script(file string, raw []scenario_incident, data input_data) ([]scripted_incident, input_errors) {
+    var script []scripted_incident
+    var errs input_errors
+    for _, r := range raw {
+        //report problem of field of incident, with path and line of incident if it comes from a file
+        fail := func(field string, format string, args ...interface{}) {
+            msg := fmt.Sprintf(format, args...)
+            if r.at != "" {
+                msg = r.at + "." + field + ": " + msg
+            }
+            errs.add(file, r.line, "%s", msg)
+        }
+        vertex := func(name string, field string) (int, bool) {
+            v, err := find_vertex(name, data.stations, data.vertex_set, data.rail_switches)
+            if err != nil {
+                fail(field, "%v", err)
+                return 0, false
+            }
+            return v, true
+        }
+        inc := scripted_incident{asset: r.Asset}
+        if t, err := time.ParseInLocation("2006-01-02 15:04", r.At, time.UTC); err == nil {
+            inc.at = t.Sub(start_time)
+        } else if clock, err := time.ParseInLocation("15:04", r.At, time.UTC); err == nil {
+            inc.at = clock_time(clock, 0)
+        } else if d, err := time.ParseDuration(r.At); err == nil {
+            inc.at = d
+        } else {
+            fail("at", "time %q is neither \"15:04\", \"2006-01-02 15:04\" nor a duration since start", r.At)
+            continue
+        }
+        if inc.at < 0 {
+            fail("at", "time %q is before start of simulation", r.At)
+            continue
+        }
+        if r.Repair != "" {
+            d, err := time.ParseDuration(r.Repair)
+            if err != nil || d <= 0 {
+                fail("repair", "repair %q must be a positive duration", r.Repair)
+                continue
+            }
+            inc.repair_time = d
+        }
+
+        ok := false
+        switch r.Asset {
+            case ASSET_RAILWAY:
+                v1, ok1 := vertex(r.From, "from")
+                v2, ok2 := vertex(r.To, "to")
+                if ok1 && ok2 && data.system[v1][v2].is_free == nil {
+                    fail("to", "railway %q -> %q does not exist", r.From, r.To)
+                } else {
+                    ok = ok1 && ok2
+                }
+                inc.vertex1, inc.vertex2 = v1, v2
+            case ASSET_RAIL_SWITCH, ASSET_PLATFORM:
+                v, found := vertex(r.Vertex, "vertex")
+                want := RAIL_SWITCH
+                if r.Asset == ASSET_PLATFORM {
+                    want = STATION
+                }
+                if found && data.vertex_set[v].vertex_type != want {
+                    fail("vertex", "vertex %q has no %s", r.Vertex, r.Asset)
+                } else if found {
+                    inc.index, ok = data.vertex_set[v].index, true
+                }
+            case ASSET_TRAIN:
+                for i, t := range data.trains {
+                    if t.name == r.Train {
+                        inc.index, ok = i, true
+                    }
+                }
+                if !ok {
+                    fail("train", "unknown train %q", r.Train)
+                }
+            default:
+                fail("asset", "unknown asset %q, must be railway, rail_switch, platform or train", r.Asset)
+        }
+        if ok {
+            script = append(script, inc)
+        }
+    }
+    sort.SliceStable(script, func(i int, j int) bool { return script[i].at < script[j].at })
+    return script, errs
+}
+
+//read and resolve incident script
+func load_script(cfg config, data input_data) ([]scenario_incident, []scripted_incident, input_errors) {
+    raw, file, errs := read_script(cfg, data)
+    if len(errs) > 0 || len(data.vertex_set) == 0 {
+        return raw, nil, errs
+    }
+    script, errs := resolve_script(file, raw, data)
+    return raw, script, errs
+}
+
+//actor of one scripted incident, sleeps until its time
+func start_incident(ctx context.Context, rng *rand.Rand, fleet *dispatcher, inc scripted_incident) {
+    if scheduler.sleep(ctx, inc.at - scheduler.now) != nil {
+        return
+    }
+    inject_incident(ctx, rng, fleet, "Incident script", inc)
+}
+
+//break asset of incident now, actor is reported as cause
+func inject_incident(ctx context.Context, rng *rand.Rand, fleet *dispatcher, actor string, inc scripted_incident) {
+    var done bool
+    switch inc.asset {
+        case ASSET_RAILWAY:
+            done = fail_railway(ctx, rng, fleet, actor, inc.vertex1, inc.vertex2, inc.repair_time)
+        case ASSET_RAIL_SWITCH:
+            done = fail_switch(ctx, rng, fleet, actor, inc.index, inc.repair_time)
+        case ASSET_PLATFORM:
+            done = fail_platform(ctx, rng, fleet, actor, inc.index, inc.repair_time)
+        case ASSET_TRAIN:
+            done = fail_train(rng, fleet, actor, inc.index, inc.repair_time)
+    }
+    if !done {
+        sim_log.emit(event{Type: EVENT_MESSAGE, Actor: actor, Detail: "Scripted " + inc.asset + " incident skipped, it is out of service already"})
+    }
+}
+
+//initialize the repair vehicle with paremeters
+func init_repair_vehicle(name string, depot int) *repair_vehicle {
+    repair_vehicle_unit := &repair_vehicle{}
+    //initialize channels in order to communicate
+
+    repair_vehicle_unit.name = name
+    repair_vehicle_unit.speed = settings.repair_speed
+    repair_vehicle_unit.STATION_VERTEX = depot
+    repair_vehicle_unit.vertex = depot
+    repair_vehicle_unit.path = make([]int, 0)
+    repair_vehicle_unit.orders = new_sim_channel()
+    repair_vehicle_unit.idle = true
+
+    return repair_vehicle_unit
+}
+
+//every vehicle of settings.fleet, single vehicle keeps its old name
+func init_fleet() []*repair_vehicle {
+    total := 0
+    for _, f := range settings.fleet {
+        total += f.vehicles
+    }
+    var vehicles []*repair_vehicle
+    for _, f := range settings.fleet {
+        for k:=0; k<f.vehicles; k++ {
+            name := REPAIR_VEHICLE_NAME
+            if total > 1 {
+                name += " " + strconv.Itoa(len(vehicles)+1)
+            }
+            vehicles = append(vehicles, init_repair_vehicle(name, f.vertex))
+        }
+    }
+    return vehicles
+}
+
+
+/* Repair dispatch */
+
+//assigns repair orders of crash to vehicles of the fleet
+type dispatcher struct {
+    policy      string
+    vehicles    []*repair_vehicle
+    pending     []repair_order //no vehicle free yet, nearest and priority policies
+    next        int            //next vehicle of round-robin policy
+    system      [][]railway
+    trains      []train
+    rail_switches []rail_switch
+    stations    []station
+    vertex_set  []vertex
+    cut_off     map[int]bool //depots without route to the rest of network
+}
+
+func new_dispatcher(policy string, vehicles []*repair_vehicle, system [][]railway, trains []train, rail_switches []rail_switch, stations []station, vertex_set []vertex) *dispatcher {
+    return &dispatcher{policy: policy, vehicles: vehicles, system: system, trains: trains, rail_switches: rail_switches, stations: stations, vertex_set: vertex_set, cut_off: map[int]bool{}}
+}
+
+//edges of route from src which avoid failed infrastructure: broken railways,
+//railways kept by broken trains or switches and broken switches on the way
+func (d *dispatcher) usable(src int) func(v1 int, v2 int) bool {
+    return func(v1 int, v2 int) bool {
+        if v1 != src && d.vertex_set[v1].vertex_type == RAIL_SWITCH && d.rail_switches[d.vertex_set[v1].index].incident != 0 {
+            return false
+        }
+        return blocking_incident(d.trains, d.system, d.rail_switches, d.vertex_set, v1, v2) == 0
+    }
+}
+
+//shortest route avoiding failures, free is false if there is none and
+//route goes through failed infrastructure, vehicle repairs it on the way then
+//nil if to can not be reached at all
+func (d *dispatcher) route(from int, to int) (path []int, free bool) {
+    if path := dijkstra(d.system, from, to, d.usable(from)); path != nil {
+        return path, true
+    }
+    return dijkstra(d.system, from, to, nil), false
+}
+
+//report depots which have lost or got back route to every other station
+func (d *dispatcher) check_depots() {
+    for _, vehicle := range d.vehicles {
+        depot := vehicle.STATION_VERTEX
+        connected := false
+        for v := range d.vertex_set {
+            if v != depot && d.vertex_set[v].vertex_type == STATION &&
+                dijkstra(d.system, depot, v, d.usable(depot)) != nil && dijkstra(d.system, v, depot, d.usable(v)) != nil {
+                connected = true
+                break
+            }
+        }
+        if connected == !d.cut_off[depot] {
+            continue
+        }
+        d.cut_off[depot] = !connected
+        if connected {
+            sim_log.emit(vertex_event(EVENT_DEPOT_RECONNECTED, "Dispatcher", depot))
+        } else {
+            stats.depot_cut_offs++
+            sim_log.emit(vertex_event(EVENT_DEPOT_CUT_OFF, "Dispatcher", depot))
+        }
+    }
+}
+
+//vehicles waiting for a token which trains keep while they wait for an incident stop waiting,
+//they take it in possession next to those trains, the repair could never come otherwise
+func (d *dispatcher) unblock() {
+    for _, vehicle := range d.vehicles {
+        if a := vehicle.actor; a != nil && a.waiting && a.blocked_on != nil && held_by_incident(a.blocked_on, d.trains) {
+            scheduler.interrupt(a)
+        }
+    }
+}
+
+//broken railway blocks every train using it, broken train only itself
+func repair_priority(repair_type int) int {
+    switch repair_type {
+        case RAILWAY_REPAIR:
+            return 3
+        case RAIL_SWITCH_REPAIR:
+            return 2
+    }
+    return 1
+}
+
+//repair time distribution of asset in order, its own or the one of fault type
+func (d *dispatcher) repair_distribution(order repair_order) distribution {
+    switch order.repair_type {
+        case RAILWAY_REPAIR:
+            if own := d.system[order.vertex1][order.vertex2].repair; own != nil {
+                return *own
+            }
+            return settings.railway_repair_time
+        case RAIL_SWITCH_REPAIR:
+            if own := d.rail_switches[d.vertex_set[order.index].index].repair; own != nil {
+                return *own
+            }
+            return settings.rail_switch_repair_time
+        case PLATFORM_REPAIR:
+            return settings.platform_repair_time
+    }
+    if own := d.trains[order.index].repair; own != nil {
+        return *own
+    }
+    return settings.train_repair_time
+}
+
+//vertex vehicle has to reach for order
+func (d *dispatcher) site(order repair_order) int {
+    switch order.repair_type {
+        case TRAIN_REPAIR:
+            t := d.trains[order.index]
+            if t.position < d.system[t.current_strech[0]][t.current_strech[1]].length {
+                return t.current_strech[0]
+            }
+            return t.current_strech[1]
+        case RAILWAY_REPAIR:
+            return order.vertex1
+    }
+    return order.index
+}
+
+//simulated time to drive from where vehicle waits to v
+func (d *dispatcher) travel_time(vehicle *repair_vehicle, v int) time.Duration {
+    path, _ := d.route(vehicle.vertex, v)
+    travel_time_in_ms := 0.0
+    for i:=0; i<len(path)-1; i++ {
+        travel_time_in_ms += get_travel_time(d.system[path[i]][path[i+1]].length, vehicle.speed, d.system[path[i]][path[i+1]].max_speed)
+    }
+    return time.Duration(travel_time_in_ms) * time.Millisecond
+}
+
+//idle vehicle with shortest route to v, nil if every vehicle is busy
+func (d *dispatcher) nearest_idle(v int) *repair_vehicle {
+    var best *repair_vehicle
+    best_km := 0.0
+    for _, vehicle := range d.vehicles {
+        if !vehicle.idle {
+            continue
+        }
+        path, _ := d.route(vehicle.vertex, v)
+        if path == nil {
+            continue
+        }
+        km := route_length(d.system, path)
+        if best == nil || km < best_km {
+            best, best_km = vehicle, km
+        }
+    }
+    return best
+}
+
+//give order to vehicle, it is queued if vehicle is busy
+func (d *dispatcher) assign(vehicle *repair_vehicle, order repair_order) {
+    vehicle.idle = false
+    sim_log.emit(event{Type: EVENT_REPAIR_ASSIGNED, Actor: "Dispatcher", Target: vehicle.name, Detail: d.policy, Incident: order.incident})
+    vehicle.orders.send(order)
+}
+
+//called by crash for every new incident,
+//vehicles waiting for railway or switch check if it blocks their way
+func (d *dispatcher) dispatch(order repair_order) {
+    d.check_depots()
+    defer func() {
+        for _, vehicle := range d.vehicles {
+            scheduler.interrupt(vehicle.actor)
+        }
+    }()
+
+    switch d.policy {
+        case DISPATCH_ROUND_ROBIN:
+            vehicle := d.vehicles[d.next]
+            d.next = (d.next + 1) % len(d.vehicles)
+            d.assign(vehicle, order)
+
+        case DISPATCH_ETA:
+            site := d.site(order)
+            var best *repair_vehicle
+            var best_eta time.Duration
+            for _, vehicle := range d.vehicles {
+                start := vehicle.free_at
+                if start < scheduler.now {
+                    start = scheduler.now
+                }
+                if eta := start + d.travel_time(vehicle, site); best == nil || eta < best_eta {
+                    best, best_eta = vehicle, eta
+                }
+            }
+            //dispatcher does not know the drawn repair time, only its mean
+            best.free_at = best_eta + d.repair_distribution(order).mean() + d.travel_time(best, site)
+            d.assign(best, order)
+
+        default: //nearest and priority wait for idle vehicle
+            if vehicle := d.nearest_idle(d.site(order)); vehicle != nil {
+                d.assign(vehicle, order)
+                return
+            }
+            d.pending = append(d.pending, order)
+            sim_log.emit(event{Type: EVENT_REPAIR_QUEUED, Actor: "Dispatcher", Detail: strconv.Itoa(len(d.pending)), Incident: order.incident})
+    }
+}
+
+//dispatch order again after a backoff, vehicle which got it could not reach the site,
+//another one or the same one from where it stands then may do
+func (d *dispatcher) retry(ctx context.Context, order repair_order) {
+    delay := UNREACHABLE_RETRY_H * time.Hour
+    for k := 0; k < order.retries && delay < UNREACHABLE_RETRY_MAX_H * time.Hour; k++ {
+        delay *= 2
+    }
+    //not a background actor, run is not deadlocked while the order may still be done
+    order.retries++
+    scheduler.spawn("Dispatcher", func() {
+        if scheduler.sleep(ctx, delay) == nil && stats.incidents[order.incident].open {
+            d.dispatch(order)
+        }
+    })
+}
+
+//remove order of incident which no vehicle has started yet, so vehicle at the asset can do it
+func (d *dispatcher) take(incident int) (repair_order, bool) {
+    for k, order := range d.pending {
+        if order.incident == incident {
+            d.pending = append(d.pending[:k], d.pending[k+1:]...)
+            return order, true
+        }
+    }
+    for _, vehicle := range d.vehicles {
+        items := vehicle.orders.items
+        for k := range items {
+            if order := items[k].(repair_order); order.incident == incident {
+                vehicle.orders.items = append(items[:k], items[k+1:]...)
+                return order, true
+            }
+        }
+    }
+    return repair_order{}, false
+}
+
+//called by vehicle which has no orders left, gives it a waiting one if there is any
+func (d *dispatcher) idle(vehicle *repair_vehicle) {
+    if len(d.pending) == 0 {
+        vehicle.idle = true
+        return
+    }
+    k := 0
+    if d.policy == DISPATCH_PRIORITY {
+        for i:=1; i<len(d.pending); i++ {
+            if repair_priority(d.pending[i].repair_type) > repair_priority(d.pending[k].repair_type) {
+                k = i
+            }
+        }
+    }
+    order := d.pending[k]
+    d.pending = append(d.pending[:k], d.pending[k+1:]...)
+    d.assign(vehicle, order)
+}
+
+
+//drive along path, railways and rail switches are reserved like by a train,
+//so vehicle waits for traffic and for broken assets on its way
+//last vertex of path is the work site or depot, its switch is not taken
+//clear is called with incident of broken asset which blocks the way and vertex where vehicle is,
+//it repairs it on the spot and returns true if no other vehicle is working on it
+//railways and switches kept by trains which wait for an incident are taken in possession next to them,
+//else vehicle and trains could wait for each other
+func send_repair_vehicle(ctx context.Context, vehicle_log *logger, clear func(incident int, at int) (bool, error), repair_vehicle_unit *repair_vehicle, trains []train, system [][]railway, rail_switches []rail_switch, vertex_set []vertex, stations []station) error {
+    stop := func(where ...string) error {
+        vehicle_log.emit(event{Type: EVENT_VEHICLE_STOPPED, Actor: repair_vehicle_unit.name, Detail: strings.Join(where, " ")})
+        return ctx.Err()
+    }
+
+    //repair whatever keeps railway reserved, new crashes can happen meanwhile
+    clear_way := func(start int, end int) error {
+        for {
+            incident := blocking_incident(trains, system, rail_switches, vertex_set, start, end)
+            if incident == 0 {
+                return nil
+            }
+            if taken, err := clear(incident, start); err != nil || !taken {
+                return err
+            }
+        }
+    }
+
+    //queue for token, clearing the way again after every new incident,
+    //dispatcher interrupts waiting as soon as the token is kept by trains waiting for an incident
+    reserve := func(t *sim_semaphore, clear_way func() error) error {
+        for {
+            if err := clear_way(); err != nil {
+                return err
+            }
+            if t.free <= 0 && held_by_incident(t, trains) {
+                t.possess()
+                return nil
+            }
+            if ok, err := t.acquire_interruptible(ctx); ok || err != nil {
+                return err
+            }
+        }
+    }
+
+    has_reservation := false //railway was taken at switch before it
+    for i:=0; i<len(repair_vehicle_unit.path)-1 ;i++{
+        start := repair_vehicle_unit.path[i]
+        end := repair_vehicle_unit.path[i+1]
+        last := i == len(repair_vehicle_unit.path)-2
+
+        if !has_reservation {
+            if err := reserve(system[start][end].is_free, func() error { return clear_way(start, end) }); err != nil {
+                return stop("while waiting for railway", strconv.Itoa(start), "->", strconv.Itoa(end))
+            }
+        }
+        has_reservation = false
+
+        vehicle_log.emit(edge_event(EVENT_VEHICLE_ENTERED_EDGE, repair_vehicle_unit.name, start, end))
+
+        //count the needed time to travel and wait
+        travel_time_in_ms := get_travel_time(system[start][end].length, repair_vehicle_unit.speed, system[start][end].max_speed)
+        if err := scheduler.sleep(ctx, time.Duration(travel_time_in_ms) * time.Millisecond); err != nil {
+            return stop("on railway", strconv.Itoa(start), "->", strconv.Itoa(end))
+        }
+
+        if vertex_set[end].vertex_type == RAIL_SWITCH && !last {
+            switch_unit := &rail_switches[vertex_set[end].index]
+
+            //wait for switch avalibility
+            clear_switch := func() error {
+                for switch_unit.incident != 0 {
+                    if taken, err := clear(switch_unit.incident, end); err != nil || !taken {
+                        return err
+                    }
+                }
+                return nil
+            }
+            if err := reserve(switch_unit.is_free, clear_switch); err != nil {
+                return stop("before railway switch at vertex", strconv.Itoa(end))
+            }
+            system[start][end].is_free.release()
+
+            //rotate switch and take next railway before leaving it
+            switch_unit.rotating.send(true)
+            vehicle_log.emit(vertex_event(EVENT_VEHICLE_AT_SWITCH, repair_vehicle_unit.name, end))
+            if _, err := switch_unit.rotate_done.receive(ctx); err != nil {
+                return stop("on railway switch at vertex", strconv.Itoa(end))
+            }
+            next_end := repair_vehicle_unit.path[i+2]
+            if err := reserve(system[end][next_end].is_free, func() error { return clear_way(end, next_end) }); err != nil {
+                return stop("on railway switch at vertex", strconv.Itoa(end))
+            }
+            has_reservation = true
+            switch_unit.is_free.release()
+            continue
+        }
+
+        system[start][end].is_free.release()
+        if vertex_set[end].vertex_type == RAIL_SWITCH {
+            vehicle_log.emit(vertex_event(EVENT_VEHICLE_AT_SWITCH, repair_vehicle_unit.name, end))
+        } else {
+            e := vertex_event(EVENT_VEHICLE_AT_STATION, repair_vehicle_unit.name, end)
+            e.Station = stations[vertex_set[end].index].name
+            vehicle_log.emit(e)
+        }
+    }
+    return nil
+}
+
+
+//incident which keeps railway start -> end reserved: railway itself, broken train halted on it
+//or broken switch at its end with trains queued before it, 0 if there is none
+func blocking_incident(trains []train, system [][]railway, rail_switches []rail_switch, vertex_set []vertex, start int, end int) int {
+    if system[start][end].incident != 0 {
+        return system[start][end].incident
+    }
+    for k := range trains {
+        t := &trains[k]
+        if t.broken && system[start][end].is_free.held_by(t.actor) {
+            return t.incident
+        }
+    }
+    if vertex_set[end].vertex_type == RAIL_SWITCH && system[start][end].is_free.free <= 0 {
+        return rail_switches[vertex_set[end].index].incident
+    }
+    return 0
+}
+
+//true if token is kept by a broken train or a failed asset out of service,
+//or by trains waiting for such a token, directly or through other trains
+func held_by_incident(t *sim_semaphore, trains []train) bool {
+    seen := map[*sim_semaphore]bool{}
+    var held func(t *sim_semaphore) bool
+    held = func(t *sim_semaphore) bool {
+        if seen[t] {
+            return false
+        }
+        seen[t] = true
+        for _, h := range t.holders {
+            if h.done { //taken out of service, see out_of_service
+                return true
+            }
+            for k := range trains {
+                if trains[k].actor == h && trains[k].broken {
+                    return true
+                }
+            }
+            if h.waiting && h.blocked_on != nil && held(h.blocked_on) {
+                return true
+            }
+        }
+        return false
+    }
+    return held(t)
+}
+
+
+//drive km along railway from start towards end, to reach a train which broke down there
+//or the switch at its end, with back set it drives the same way back to start
+//railway is kept by trains waiting for the incident, vehicle takes it in possession next to them until it is back
+func drive_on_railway(ctx context.Context, vehicle_log *logger, repair_vehicle_unit *repair_vehicle, system [][]railway, start int, end int, km float64, back bool) error {
+    if !back {
+        system[start][end].is_free.possess()
+    }
+    travel_time_in_ms := get_travel_time(km, repair_vehicle_unit.speed, system[start][end].max_speed)
+    if err := scheduler.sleep(ctx, time.Duration(travel_time_in_ms) * time.Millisecond); err != nil {
+        e := edge_event(EVENT_VEHICLE_STOPPED, repair_vehicle_unit.name, start, end)
+        e.Detail = "on railway " + e.Edge
+        vehicle_log.emit(e)
+        return err
+    }
+    if back {
+        system[start][end].is_free.release()
+    }
+    return nil
+}
+
+
+func start_repair_vehicle(ctx context.Context, repair_vehicle_unit *repair_vehicle, fleet *dispatcher, trains []train, system [][]railway, rail_switches []rail_switch, vertex_set []vertex, stations []station) {
+
+    //log file
+    vehicle_log := sim_log.open(repair_vehicle_unit.name)
+    defer vehicle_log.close()
+
+    //repair order, at is vertex next to the asset where vehicle is already, -1 to drive from depot
+    var work func(order repair_order, at int) error
+
+    //broken asset on the way which no other vehicle is working on, repair it on the spot
+    clear := func(incident int, at int) (bool, error) {
+        order, ok := fleet.take(incident)
+        if !ok {
+            return false, nil
+        }
+        return true, work(order, at)
+    }
+
+    //drive along whole railway to switch at its end, trains queued there keep it reserved
+    to_switch := func(start int, end int) func(back bool) error {
+        return func(back bool) error {
+            if !back {
+                vehicle_log.emit(edge_event(EVENT_VEHICLE_ENTERED_EDGE, repair_vehicle_unit.name, start, end))
+            }
+            return drive_on_railway(ctx, vehicle_log, repair_vehicle_unit, system, start, end, system[start][end].length, back)
+        }
+    }
+
+    //set path around failed infrastructure, report if there is none
+    find_route := func(from int, to int) bool {
+        path, free := fleet.route(from, to)
+        if !free {
+            e := event{Type: EVENT_NO_ROUTE, Actor: repair_vehicle_unit.name, Vertices: []int{from, to}, Detail: "will repair failures on the way"}
+            if path == nil {
+                e.Detail = "vertex can not be reached"
+            }
+            vehicle_log.emit(e)
+        }
+        repair_vehicle_unit.path = path
+        return path != nil
+    }
+
+    //drive to destination, repair and come back
+    //approach is called at destination to reach the asset and with back set to leave it, can be nil
+    do_job := func(order repair_order, here bool, destination int, approach func(back bool) error, repair func()) error {
+        if !here {
+            //find path to destination, order is dispatched again later if there is none
+            if !find_route(repair_vehicle_unit.vertex, destination) {
+                stats.unreachable++
+                fleet.retry(ctx, order)
+                return nil
+            }
+
+            if err := send_repair_vehicle(ctx, vehicle_log, clear, repair_vehicle_unit, trains, system, rail_switches, vertex_set, stations); err != nil {
+                return err
+            }
+        }
+        if approach != nil {
+            if err := approach(false); err != nil {
+                return err
+            }
+        }
+
+        //repair
+        if err := scheduler.sleep(ctx, order.repair_time); err != nil {
+            vehicle_log.emit(event{Type: EVENT_VEHICLE_STOPPED, Actor: repair_vehicle_unit.name, Detail: "before the repair was done"})
+            return err
+        }
+        repair()
+        count_repair(order.incident)
+        fleet.check_depots()
+
+        if approach != nil {
+            if err := approach(true); err != nil {
+                return err
+            }
+        }
+        if here {
+            return nil
+        }
+        //without a way back vehicle waits at the site, next job starts from there
+        repair_vehicle_unit.vertex = destination
+        if !find_route(destination, repair_vehicle_unit.STATION_VERTEX) {
+            return nil
+        }
+        if err := send_repair_vehicle(ctx, vehicle_log, clear, repair_vehicle_unit, trains, system, rail_switches, vertex_set, stations); err != nil {
+            return err
+        }
+        repair_vehicle_unit.vertex = repair_vehicle_unit.STATION_VERTEX
+
+        vehicle_log.emit(vertex_event(EVENT_VEHICLE_RETURNED, repair_vehicle_unit.name, repair_vehicle_unit.STATION_VERTEX))
+        return nil
+    }
+
+    work = func(order repair_order, at int) error {
+        var err error
+        here := at >= 0
+        stats.incidents[order.incident].dispatched = scheduler.now
+        stats.incidents[order.incident].vehicle = repair_vehicle_unit.name
+        switch order.repair_type {
+            case TRAIN_REPAIR:
+                train_index := order.index
+                train_unit := &trains[train_index]
+                start := train_unit.current_strech[0]
+                end := train_unit.current_strech[1]
+                e := event{Type: EVENT_REPAIR_DISPATCHED, Actor: repair_vehicle_unit.name, Asset: ASSET_TRAIN, Target: train_unit.name, Vertices: []int{end}, Incident: order.incident}
+                destination := end
+                var approach func(back bool) error
+                //halted on railway, or vehicle waits at its start for railway the train keeps, drive there from its start
+                if train_unit.position < system[start][end].length || at == start {
+                    e = edge_event(EVENT_REPAIR_DISPATCHED, repair_vehicle_unit.name, start, end)
+                    e.Asset = ASSET_TRAIN
+                    e.Target = train_unit.name
+                    e.Incident = order.incident
+                    destination = start
+                    km := train_unit.position
+                    approach = func(back bool) error {
+                        if !back {
+                            vehicle_log.emit(edge_event(EVENT_VEHICLE_ENTERED_EDGE, repair_vehicle_unit.name, start, end))
+                        }
+                        if err := drive_on_railway(ctx, vehicle_log, repair_vehicle_unit, system, start, end, km, back); err != nil {
+                            return err
+                        }
+                        if !back {
+                            vehicle_log.emit(event{Type: EVENT_VEHICLE_AT_TRAIN, Actor: repair_vehicle_unit.name, Target: train_unit.name, Vertices: []int{start, end}, Detail: fmt.Sprintf("%.1f km from vertex %d", km, start), Incident: order.incident})
+                        }
+                        return nil
+                    }
+                }
+                e.Detail = order.repair_time.String()
+                vehicle_log.emit(e)
+                err = do_job(order, here, destination, approach, func() {
+                    train_unit.repaired.send(true)
+                    train_unit.broken = false
+                    train_unit.health.repaired()
+                    vehicle_log.emit(event{Type: EVENT_REPAIR_COMPLETED, Actor: repair_vehicle_unit.name, Asset: ASSET_TRAIN, Target: train_unit.name, Incident: order.incident})
+                })
+
+            case RAIL_SWITCH_REPAIR:
+                rail_switch_vertex_index := order.index
+                vehicle_log.emit(event{Type: EVENT_REPAIR_DISPATCHED, Actor: repair_vehicle_unit.name, Asset: ASSET_RAIL_SWITCH, Vertices: []int{rail_switch_vertex_index}, Detail: order.repair_time.String(), Incident: order.incident})
+                var approach func(back bool) error
+                if here && at != rail_switch_vertex_index {
+                    approach = to_switch(at, rail_switch_vertex_index)
+                }
+                err = do_job(order, here, rail_switch_vertex_index, approach, func() {
+                    rail_switches[vertex_set[rail_switch_vertex_index].index].incident = 0
+                    rail_switches[vertex_set[rail_switch_vertex_index].index].health.repaired()
+                    order.restore()
+                    vehicle_log.emit(event{Type: EVENT_REPAIR_COMPLETED, Actor: repair_vehicle_unit.name, Asset: ASSET_RAIL_SWITCH, Vertices: []int{rail_switch_vertex_index}, Incident: order.incident})
+                })
+
+            case RAILWAY_REPAIR:
+                railway_index_1 := order.vertex1
+                railway_index_2 := order.vertex2
+                e := edge_event(EVENT_REPAIR_DISPATCHED, repair_vehicle_unit.name, railway_index_1, railway_index_2)
+                e.Asset = ASSET_RAILWAY
+                e.Detail = order.repair_time.String()
+                e.Incident = order.incident
+                vehicle_log.emit(e)
+                err = do_job(order, here, railway_index_1, nil, func() {
+                    system[railway_index_1][railway_index_2].incident = 0
+                    system[railway_index_1][railway_index_2].health.repaired()
+                    order.restore()
+                    e := edge_event(EVENT_REPAIR_COMPLETED, repair_vehicle_unit.name, railway_index_1, railway_index_2)
+                    e.Asset = ASSET_RAILWAY
+                    e.Incident = order.incident
+                    vehicle_log.emit(e)
+                })
+
+            case PLATFORM_REPAIR:
+                station_vertex_index := order.index
+                station_unit := &stations[vertex_set[station_vertex_index].index]
+                e := station_event(EVENT_REPAIR_DISPATCHED, repair_vehicle_unit.name, station_vertex_index, station_unit.name)
+                e.Asset = ASSET_PLATFORM
+                e.Detail = order.repair_time.String()
+                e.Incident = order.incident
+                vehicle_log.emit(e)
+                err = do_job(order, here, station_vertex_index, nil, func() {
+                    station_unit.closed_platforms--
+                    order.restore()
+                    e := station_event(EVENT_REPAIR_COMPLETED, repair_vehicle_unit.name, station_vertex_index, station_unit.name)
+                    e.Asset = ASSET_PLATFORM
+                    e.Incident = order.incident
+                    vehicle_log.emit(e)
+                })
+        }
+        return err
+    }
+
+    //keep waiting for crash
+    for {
+        if len(repair_vehicle_unit.orders.items) == 0 {
+            fleet.idle(repair_vehicle_unit)
+        }
+        item, err := repair_vehicle_unit.orders.receive(ctx)
+        if err != nil {
+            return
+        }
+        repair_vehicle_unit.idle = false
+        if work(item.(repair_order), -1) != nil {
+            return
+        }
+    }
+}
+
+  
+
+
+//thread function for every train
+func start_train(
+    ctx context.Context,
+    train_unit *train,
+    trains []train,
+    system [][]railway,
+    stations []station,
+    vertex_set []vertex,
+    rail_switches []rail_switch) {
+
+    //logs file for every train
+    train_log := sim_log.open(train_unit.name)
+    defer train_log.close()
+
+    run := 1 //of timetable, next run starts when train is back at first vertex of path
+    next_stop := 0 //first stop of timetable not reached yet
+    var late *float64 //minutes behind timetable at last scheduled stop, nil before first one
+
+    //every event of train tells how late it is
+    emit := func(e event) {
+        e.Late = late
+        train_log.emit(e)
+    }
+
+    //stop of timetable at stage of current run, nil if it is not scheduled
+    scheduled := func(stage int) *scheduled_stop {
+        if next_stop < len(train_unit.timetable) && train_unit.timetable[next_stop].run == run && train_unit.timetable[next_stop].stage == stage {
+            next_stop++
+            return &train_unit.timetable[next_stop-1]
+        }
+        return nil
+    }
+
+    //compare now with scheduled time of station, kind is arrival or departure
+    behind := func(plan *scheduled_stop, station_name string, kind string) {
+        at := plan.arrival
+        if kind == SCHEDULE_DEPARTURE {
+            at = plan.departure
+        }
+        train_unit.late = scheduler.now - at
+        minutes := train_unit.late.Round(time.Second).Minutes()
+        late = &minutes
+        count_late(late_record{
+            train: train_unit.name,
+            line: train_unit.line,
+            station: station_name,
+            kind: kind,
+            late: train_unit.late,
+            causes: train_unit.ledger.measure(train_unit.late),
+            stop: kind == SCHEDULE_ARRIVAL || plan.arrival < 0,
+        })
+    }
+
+    //take token, time spent waiting for it is lost to cause found when waiting starts,
+    //a train breaking down meanwhile stops waiting and halts at vertex until it is repaired
+    var halt func(at int) error
+    reserve := func(token *sim_semaphore, at int, cause func() string) error {
+        for {
+            why, since := "", scheduler.now
+            if token.free <= 0 {
+                why = cause()
+            }
+            ok, err := token.acquire_interruptible(ctx)
+            train_unit.ledger.wait(why, scheduler.now - since)
+            if err != nil {
+                return err
+            }
+            if err := halt(at); err != nil {
+                return err
+            }
+            if ok {
+                return nil
+            }
+        }
+    }
+    railway_wait := func(v1 int, v2 int) func() string {
+        return func() string { return railway_cause(trains, system, train_unit, v1, v2) }
+    }
+
+    //trains never leave before scheduled departure
+    wait_for_departure := func(plan *scheduled_stop) error {
+        if plan == nil || plan.departure < scheduler.now {
+            return nil
+        }
+        return scheduler.sleep(ctx, plan.departure - scheduler.now)
+    }
+
+    //display logs
+    emit(event{Type: EVENT_TRAIN_STARTED, Actor: train_unit.name})
+
+    //simulation is over, leave current stretch where it is
+    stop := func(where ...string) {
+        emit(event{Type: EVENT_TRAIN_STOPPED, Actor: train_unit.name, Vertices: []int{train_unit.current_strech[0], train_unit.current_strech[1]}, Detail: strings.Join(where, " ")})
+    }
+
+    //stay where train is until repair vehicle has repaired it,
+    //leftover message of a repair done while train was moving is skipped
+    wait_for_repair := func() error {
+        since := scheduler.now
+        for train_unit.broken {
+            if _, err := train_unit.repaired.receive(ctx); err != nil {
+                return err
+            }
+        }
+        train_unit.ledger.wait(CAUSE_CRASH, scheduler.now - since)
+        emit(event{Type: EVENT_TRAIN_RESUMED, Actor: train_unit.name, Incident: train_unit.incident})
+        return nil
+    }
+
+    //train broke down while standing at vertex, it stays there until repaired
+    halt = func(at int) error {
+        if !train_unit.broken {
+            return nil
+        }
+        e := vertex_event(EVENT_TRAIN_BROKE_DOWN, train_unit.name, at)
+        e.Incident = train_unit.incident
+        emit(e)
+        return wait_for_repair()
+    }
+
+    route := train_unit.route()
+    i := 0 //actual route stage
+    has_reservation := false
+
+    //first departure of timetable from first vertex of path
+    if plan := scheduled(0); plan != nil && plan.departure >= 0 {
+        origin := stations[vertex_set[route[0]].index].name
+        train_unit.current_strech[0], train_unit.current_strech[1] = route[0], route[1]
+        if wait_for_departure(plan) != nil || halt(route[0]) != nil {
+            stop("at station", origin)
+            return
+        }
+        if reserve(system[route[0]][route[1]].is_free, route[0], railway_wait(route[0], route[1])) != nil {
+            stop("at station", origin)
+            return
+        }
+        has_reservation = true
+        behind(plan, origin, SCHEDULE_DEPARTURE)
+    }
+
+    //start traveling, endless loop
+    for{
+
+        //starting and ending vertex
+        start := route[i]
+        end := route[(i+1) % len(route)]
+
+        //train at start of next railway, it may hold it already
+        train_unit.current_strech[0] = start
+        train_unit.current_strech[1] = end
+        train_unit.position = 0
+
+        if halt(start) != nil {
+            stop("while waiting for repair")
+            return
+        }
+
+        if !has_reservation{ //if train has reservated this railway before skip waiting for avalibility
+            if reserve(system[start][end].is_free, start, railway_wait(start, end)) != nil {
+                stop("while waiting for railway",strconv.Itoa(start),"->",strconv.Itoa(end))
+                return
+            }
+        }
+           
+        emit(edge_event(EVENT_TRAIN_ENTERED_EDGE, train_unit.name, start, end))
+
+        //count the needed time to travel and wait
+        travel_time_in_ms := get_travel_time(system[start][end].length, train_unit.speed, system[start][end].max_speed)
+        travel_time := time.Duration(travel_time_in_ms) * time.Millisecond
+        left := travel_time
+        for left > 0 {
+            var err error
+            train_unit.moving, train_unit.moving_since = true, scheduler.now
+            train_unit.kmh = system[start][end].length / travel_time.Hours()
+            left, err = scheduler.sleep_interruptible(ctx, left)
+            train_unit.moving = false
+            if err != nil {
+                stop("on railway",strconv.Itoa(start),"->",strconv.Itoa(end))
+                return
+            }
+            if left > 0 { //broken down, halt here keeping the railway reserved
+                train_unit.position = system[start][end].length * float64(travel_time - left) / float64(travel_time)
+                e := edge_event(EVENT_TRAIN_BROKE_DOWN, train_unit.name, start, end)
+                e.Detail = fmt.Sprintf("%.1f km from vertex %d", train_unit.position, start)
+                e.Incident = train_unit.incident
+                emit(e)
+                if wait_for_repair() != nil {
+                    stop("while waiting for repair on railway",strconv.Itoa(start),"->",strconv.Itoa(end))
+                    return
+                }
+            }
+        }
+        train_unit.position = system[start][end].length
+        train_unit.health.use(system[start][end].length)
+        system[start][end].health.use(system[start][end].length)
+        stats.stretches[train_unit.name]++
+        if (i+1) % len(route) == 0 {
+            run++
+        }
+
+        if vertex_set[end].vertex_type == RAIL_SWITCH { //arrived to rail switch
+
+            //wait for switch avalibility
+            switch_wait := func() string { return switch_cause(trains, system, rail_switches, vertex_set, train_unit, end) }
+            if reserve(rail_switches[vertex_set[end].index].is_free, end, switch_wait) != nil {
+                stop("before railway switch at vertex", strconv.Itoa(end))
+                return
+            }
+
+            //now train can free used railway
+            system[start][end].is_free.release()
+
+            //start rotating switch
+            rail_switches[vertex_set[end].index].rotating.send(true)
+
+            emit(vertex_event(EVENT_TRAIN_AT_SWITCH, train_unit.name, end))
+
+            //wait for rotating over
+            if _, err := rail_switches[vertex_set[end].index].rotate_done.receive(ctx); err != nil || halt(end) != nil {
+                stop("on railway switch at vertex", strconv.Itoa(end))
+                return
+            }
+
+            //check next railway avalibility before leaving switch
+            next_start := end
+            next_end := route[(i+2) % len(route)]
+            if reserve(system[next_start][next_end].is_free, end, railway_wait(next_start, next_end)) != nil {
+                stop("on railway switch at vertex", strconv.Itoa(end))
+                return
+            }
+            //next railway avalible, train has reservation now
+            has_reservation = true 
+            train_unit.current_strech[0], train_unit.current_strech[1], train_unit.position = next_start, next_end, 0
+
+            //now train can free used switch
+            rail_switches[vertex_set[end].index].is_free.release()
+
+        } else { //arrived to station
+
+            //wait for avalible platform
+            platform_wait := func() string { return platform_cause(trains, system, stations, vertex_set, train_unit, end) }
+            if reserve(stations[vertex_set[end].index].free_platforms, end, platform_wait) != nil {
+                stop("before station", stations[vertex_set[end].index].name)
+                return
+            }
+            //now train can free used railway
+            system[start][end].is_free.release()
+
+            plan := scheduled((i+1) % len(route))
+            arrived := station_event(EVENT_TRAIN_ARRIVED_STATION, train_unit.name, end, stations[vertex_set[end].index].name)
+            if plan != nil && plan.arrival >= 0 {
+                behind(plan, stations[vertex_set[end].index].name, SCHEDULE_ARRIVAL)
+                arrived.scheduled = true
+            }
+            emit(arrived)
+            stats.stops[train_unit.name]++
+            if n := alight(train_unit, end); n > 0 {
+                e := station_event(EVENT_PASSENGERS_ALIGHTED, train_unit.name, end, stations[vertex_set[end].index].name)
+                e.Passengers, e.Load = n, train_unit.people
+                emit(e)
+            }
+
+            //end of one-shot run, leave platform for depot of station
+            if train_unit.service == SERVICE_ONE_SHOT && i+1 == len(route)-1 {
+                if stations[vertex_set[end].index].free_depots.acquire(ctx) != nil || halt(end) != nil {
+                    stop("at station", stations[vertex_set[end].index].name)
+                    return
+                }
+                stations[vertex_set[end].index].free_platforms.release()
+                train_unit.finished = true
+                emit(station_event(EVENT_TRAIN_FINISHED, train_unit.name, end, stations[vertex_set[end].index].name))
+                count_lap(train_unit.name)
+                count_finished(train_unit.name)
+                return
+            }
+
+            //count the needed time to wait at platform, shuttle turns around at both ends
+            wait_time_in_ms := stations[vertex_set[end].index].wait_time * 60000
+            if stage := (i+1) % len(route); train_unit.service == SERVICE_SHUTTLE && (stage == 0 || stage == len(train_unit.path)-1) {
+                emit(station_event(EVENT_TRAIN_REVERSED, train_unit.name, end, stations[vertex_set[end].index].name))
+                if train_unit.turnaround > 0 {
+                    wait_time_in_ms = train_unit.turnaround * 60000
+                }
+            }
+            if scheduler.sleep(ctx, time.Millisecond * time.Duration(wait_time_in_ms)) != nil || halt(end) != nil {
+                stop("at station", stations[vertex_set[end].index].name)
+                return
+            }
+
+            //get people from platform
+            if settings.demand != nil {
+                station_unit := &stations[vertex_set[end].index]
+                e := station_event(EVENT_PASSENGERS_BOARDED, train_unit.name, end, station_unit.name)
+                e.Passengers = board(train_unit, station_unit, (i+1) % len(route))
+                e.Load, e.Queue = train_unit.people, len(station_unit.waiting)
+                emit(e)
+            }
+
+            emit(station_event(EVENT_TRAIN_READY, train_unit.name, end, stations[vertex_set[end].index].name))
+
+            //held by console, stay at platform without reserving next railway
+            if train_unit.held {
+                emit(station_event(EVENT_TRAIN_HELD, train_unit.name, end, stations[vertex_set[end].index].name))
+                since := scheduler.now
+                for train_unit.held {
+                    if _, err := train_unit.released.receive(ctx); err != nil {
+                        stop("held at station", stations[vertex_set[end].index].name)
+                        return
+                    }
+                }
+                train_unit.ledger.wait(CAUSE_HELD, scheduler.now - since)
+                emit(station_event(EVENT_TRAIN_RELEASED, train_unit.name, end, stations[vertex_set[end].index].name))
+            }
+            
+            if wait_for_departure(plan) != nil || halt(end) != nil {
+                stop("at station", stations[vertex_set[end].index].name)
+                return
+            }
+
+            //check next railway before leaving station
+            next_start := end
+            next_end := route[(i+2) % len(route)]
+            if reserve(system[next_start][next_end].is_free, end, railway_wait(next_start, next_end)) != nil {
+                stop("at station", stations[vertex_set[end].index].name)
+                return
+            }
+            has_reservation = true 
+            left := station_event(EVENT_TRAIN_LEFT_STATION, train_unit.name, end, stations[vertex_set[end].index].name)
+            if plan != nil && plan.departure >= 0 {
+                behind(plan, stations[vertex_set[end].index].name, SCHEDULE_DEPARTURE)
+                left.scheduled = true
+            }
+            train_unit.current_strech[0], train_unit.current_strech[1], train_unit.position = next_start, next_end, 0
+
+            stations[vertex_set[end].index].free_platforms.release()
+
+            emit(left)
+
+        }
+
+        //next stage
+        i = (i+1) % len(route)
+        if i == 0 {
+            count_lap(train_unit.name)
+        }
+    }
+}
+
+
+/* Timetable */
+
+//row of timetable, station is given by name, times are "15:04" or "2006-01-02 15:04",
+//a clock time earlier than the one before it of the same train is on the next day
+type scenario_stop struct {
+    Train       string  `json:"train"`
+    Run         int     `json:"run"` //lap of train, first is 1
+    Station     string  `json:"station"`
+    Arrival     string  `json:"arrival,omitempty"` //empty = not scheduled
+    Departure   string  `json:"departure,omitempty"`
+    line        int     //of stop in timetable or scenario file
+    at          string  //JSON path of stop, empty for timetable file
+}
+
+//station stop of timetable
+type scheduled_stop struct {
+    run         int //lap of train, first is 1
+    stage       int //position of station in path, 0 = first vertex
+    arrival     time.Duration //since start of simulation, -1 = not scheduled
+    departure   time.Duration
+}
+
+//read timetable.txt of data directory, "-" is a time which is not scheduled
+func read_timetable(path string, errs *input_errors) []scenario_stop {
+    const (TRAIN = iota; RUN; STATION; ARRIVAL; DEPARTURE)
+    t := read_table(path, []string{"TRAIN", "RUN", "STATION", "ARRIVAL", "DEPARTURE"}, errs)
+    t.check_count(errs)
+    var raw []scenario_stop
+    optional := func(text string) string {
+        if text == "-" {
+            return ""
+        }
+        return text
+    }
+    for _, row := range t.rows {
+        raw = append(raw, scenario_stop{
+            Train: t.text(row, TRAIN),
+            Run: t.int(row, RUN, errs),
+            Station: t.text(row, STATION),
+            Arrival: optional(t.text(row, ARRIVAL)),
+            Departure: optional(t.text(row, DEPARTURE)),
+            line: row.line,
+        })
+    }
+    return raw
+}
+
+//scheduled time of timetable, it must not be before time of previous stop
+func parse_schedule(text string, previous time.Duration) (time.Duration, error) {
+    if t, err := time.ParseInLocation("2006-01-02 15:04", text, time.UTC); err == nil {
+        if t.Sub(start_time) < previous {
+            return 0, fmt.Errorf("time %q is before previous time of train", text)
+        }
+        return t.Sub(start_time), nil
+    }
+    clock, err := time.ParseInLocation("15:04", text, time.UTC)
+    if err != nil {
+        return 0, fmt.Errorf("time %q is neither \"15:04\" nor \"2006-01-02 15:04\"", text)
+    }
+    return clock_time(clock, previous), nil
+}
+
+//time of day of clock on start day of simulation, or on the first day after it where it is not before previous
+func clock_time(clock time.Time, previous time.Duration) time.Duration {
+    day := time.Date(start_time.Year(), start_time.Month(), start_time.Day(), clock.Hour(), clock.Minute(), 0, 0, time.UTC)
+    at := day.Sub(start_time)
+    for at < previous {
+        at += 24 * time.Hour
+    }
+    return at
+}
+
+//check rows of timetable and put them into trains, rows of a train have to be in order of travel
+func resolve_timetable(file string, raw []scenario_stop, data input_data) input_errors {
+    var errs input_errors
+    type cursor struct {
+        run     int
+        stage   int
+        at      time.Duration
+    }
+    cursors := map[string]*cursor{}
+
+    for _, r := range raw {
+        fail := func(format string, args ...interface{}) {
+            msg := fmt.Sprintf(format, args...)
+            if r.at != "" {
+                msg = r.at + ": " + msg
+            }
+            errs.add(file, r.line, "%s", msg)
+        }
+        indx := -1
+        for i, t := range data.trains {
+            if t.name == r.Train {
+                indx = i
+            }
+        }
+        if indx < 0 {
+            fail("unknown train %q", r.Train)
+            continue
+        }
+        train_unit := &data.trains[indx]
+        c := cursors[r.Train]
+        if c == nil {
+            c = &cursor{run: 1, stage: -1}
+            cursors[r.Train] = c
+        }
+        if r.Run < c.run {
+            fail("run %d of %s comes after run %d", r.Run, r.Train, c.run)
+            continue
+        }
+        if r.Run > c.run {
+            c.run, c.stage = r.Run, -1
+        }
+
+        //next visit of station on path
+        stage := -1
+        route := train_unit.route()
+        for i:=c.stage+1; i<len(route); i++ {
+            v := route[i]
+            if data.vertex_set[v].vertex_type == STATION && data.stations[data.vertex_set[v].index].name == r.Station {
+                stage = i
+                break
+            }
+        }
+        if stage < 0 {
+            fail("%s does not stop at %q later in run %d", r.Train, r.Station, r.Run)
+            continue
+        }
+        c.stage = stage
+
+        stop := scheduled_stop{run: r.Run, stage: stage, arrival: -1, departure: -1}
+        if r.Arrival == "" && r.Departure == "" {
+            fail("stop at %q needs an arrival or a departure", r.Station)
+            continue
+        }
+        if r.Arrival != "" && r.Run == 1 && stage == 0 {
+            fail("%s starts at %q, run 1 has no arrival there", r.Train, r.Station)
+            continue
+        }
+        var err error
+        if r.Arrival != "" {
+            if stop.arrival, err = parse_schedule(r.Arrival, c.at); err != nil {
+                fail("arrival: %v", err)
+                continue
+            }
+            c.at = stop.arrival
+        }
+        if r.Departure != "" {
+            if stop.departure, err = parse_schedule(r.Departure, c.at); err != nil {
+                fail("departure: %v", err)
+                continue
+            }
+            c.at = stop.departure
+        }
+        train_unit.timetable = append(train_unit.timetable, stop)
+    }
+    return errs
+}
+
+//minutes behind timetable as text
+func lateness(minutes float64) string {
+    switch {
+        case minutes > 0:
+            return fmt.Sprintf("%.1f min late", minutes)
+        case minutes < 0:
+            return fmt.Sprintf("%.1f min early", -minutes)
+    }
+    return "on time"
+}
+
+
+/* Punctuality */
+
+//causes in order of report
+var delay_causes = []string{CAUSE_RAILWAY, CAUSE_PLATFORM, CAUSE_SWITCH, CAUSE_CRASH, CAUSE_KNOCK_ON, CAUSE_HELD, CAUSE_RUNNING}
+
+//on time limits of punctuality report, written as "3m,5m,15m"
+type thresholds []time.Duration
+
+func (t *thresholds) String() string {
+    parts := make([]string, len(*t))
+    for k, d := range *t {
+        parts[k] = strings.TrimSuffix(d.String(), "0s")
+    }
+    return strings.Join(parts, ",")
+}
+
+func (t *thresholds) Set(text string) error {
+    var limits thresholds
+    for _, part := range strings.Split(text, ",") {
+        d, err := time.ParseDuration(strings.TrimSpace(part))
+        if err != nil || d < 0 {
+            return fmt.Errorf("%q is not a duration like 5m", part)
+        }
+        limits = append(limits, d)
+    }
+    sort.Slice(limits, func(i int, j int) bool { return limits[i] < limits[j] })
+    *t = limits
+    return nil
+}
+
+//delay of train split into root causes, kept by train actor
+type delay_ledger struct {
+    lost    map[string]time.Duration //waiting since last scheduled time
+    delay   map[string]time.Duration //causes of delay at last scheduled time
+}
+
+//time spent waiting for cause
+func (l *delay_ledger) wait(cause string, d time.Duration) {
+    if d <= 0 {
+        return
+    }
+    if l.lost == nil {
+        l.lost = map[string]time.Duration{}
+    }
+    l.lost[cause] += d
+}
+
+//delay at scheduled time split into causes, growth of delay is shared among
+//the waits since the last scheduled time, the rest of it is lost running,
+//delay made up shrinks every cause alike
+func (l *delay_ledger) measure(late time.Duration) map[string]time.Duration {
+    if late < 0 {
+        late = 0
+    }
+    before := time.Duration(0)
+    for _, d := range l.delay {
+        before += d
+    }
+    lost := time.Duration(0)
+    for _, d := range l.lost {
+        lost += d
+    }
+
+    delay := map[string]time.Duration{}
+    switch grown := late - before; {
+        case grown > 0:
+            for cause, d := range l.delay {
+                delay[cause] = d
+            }
+            share := 1.0
+            if lost > grown {
+                share = float64(grown) / float64(lost)
+            }
+            for cause, d := range l.lost {
+                part := time.Duration(float64(d) * share)
+                delay[cause] += part
+                grown -= part
+            }
+            if grown > 0 {
+                delay[CAUSE_RUNNING] += grown
+            }
+        case late > 0:
+            for cause, d := range l.delay {
+                delay[cause] = time.Duration(float64(d) * float64(late) / float64(before))
+            }
+    }
+    l.delay, l.lost = delay, nil
+    return delay
+}
+
+//true if train stands at vertex v, on a platform or on a switch
+func standing_at(t *train, v int, system [][]railway) bool {
+    if t.moving {
+        return false
+    }
+    v1, v2 := t.current_strech[0], t.current_strech[1]
+    return (v2 == v && t.position == system[v1][v2].length) || (v1 == v && t.position == 0)
+}
+
+//cause of waiting for a token held by trains which match, without such train
+//a repair vehicle holds it
+func blocking_cause(trains []train, waiting *train, holds func(t *train) bool, free_cause string) string {
+    found := false
+    for k := range trains {
+        t := &trains[k]
+        if t == waiting || t.finished || !holds(t) {
+            continue
+        }
+        if t.broken {
+            return CAUSE_CRASH
+        }
+        if t.late > 0 {
+            return CAUSE_KNOCK_ON
+        }
+        found = true
+    }
+    if !found {
+        return CAUSE_CRASH
+    }
+    return free_cause
+}
+
+//cause of train waiting for railway v1 -> v2
+func railway_cause(trains []train, system [][]railway, waiting *train, v1 int, v2 int) string {
+    if system[v1][v2].incident != 0 {
+        return CAUSE_CRASH
+    }
+    return blocking_cause(trains, waiting, func(t *train) bool { return t.current_strech[0] == v1 && t.current_strech[1] == v2 }, CAUSE_RAILWAY)
+}
+
+//cause of train waiting for rail switch at vertex v
+func switch_cause(trains []train, system [][]railway, rail_switches []rail_switch, vertex_set []vertex, waiting *train, v int) string {
+    if rail_switches[vertex_set[v].index].incident != 0 {
+        return CAUSE_CRASH
+    }
+    return blocking_cause(trains, waiting, func(t *train) bool { return standing_at(t, v, system) }, CAUSE_SWITCH)
+}
+
+//cause of train waiting for platform of station at vertex v,
+//platforms closed by a crash make it a crash
+func platform_cause(trains []train, system [][]railway, stations []station, vertex_set []vertex, waiting *train, v int) string {
+    station_unit := &stations[vertex_set[v].index]
+    if station_unit.closed_platforms > len(station_unit.console_closed) {
+        return CAUSE_CRASH
+    }
+    cause := blocking_cause(trains, waiting, func(t *train) bool { return standing_at(t, v, system) }, CAUSE_PLATFORM)
+    if cause == CAUSE_CRASH && len(station_unit.console_closed) > 0 {
+        return CAUSE_PLATFORM
+    }
+    return cause
+}
+
+//punctuality of scheduled stops, arrivals count and departures of stops without one
+type punctuality struct {
+    stops   int
+    on_time []int //by threshold
+    delay   time.Duration //sum of lateness
+}
+
+func (p *punctuality) add(late time.Duration, limits thresholds) {
+    if p.on_time == nil {
+        p.on_time = make([]int, len(limits))
+    }
+    p.stops++
+    for k, limit := range limits {
+        if late <= limit {
+            p.on_time[k]++
+        }
+    }
+    if late > 0 {
+        p.delay += late
+    }
+}
+
+//line of report, share of stops on time for every threshold
+func (p *punctuality) text(limits thresholds) string {
+    shares := make([]string, len(limits))
+    for k := range limits {
+        shares[k] = fmt.Sprintf("%.0f%%", 100 * float64(p.on_time[k]) / float64(p.stops))
+    }
+    return fmt.Sprintf("%d stops, on time %s, %.0f delay minutes, %.1f per stop", p.stops, strings.Join(shares, " / "), p.delay.Minutes(), p.delay.Minutes() / float64(p.stops))
+}
+
+//on time performance per train, station and line, and delay minutes by cause
+func print_punctuality(out *os.File, trains []train, stations []station) {
+    limits := settings.on_time
+    by_train, by_station, by_line := map[string]*punctuality{}, map[string]*punctuality{}, map[string]*punctuality{}
+    var all punctuality
+    causes := map[string]time.Duration{}
+    count := func(m map[string]*punctuality, key string, late time.Duration) {
+        if m[key] == nil {
+            m[key] = &punctuality{}
+        }
+        m[key].add(late, limits)
+    }
+    for _, r := range stats.schedule {
+        if !r.stop {
+            continue
+        }
+        count(by_train, r.train, r.late)
+        count(by_station, r.station, r.late)
+        count(by_line, r.line, r.late)
+        all.add(r.late, limits)
+        for cause, d := range r.causes {
+            causes[cause] += d
+        }
+    }
+    if all.stops == 0 {
+        return
+    }
+
+    fmt.Fprintf(out, "    punctuality, on time = at most %s late:\n", strings.Replace(limits.String(), ",", " / ", -1))
+    fmt.Fprintf(out, "        all: %s\n", all.text(limits))
+    var lines []string
+    for line := range by_line {
+        lines = append(lines, line)
+    }
+    sort.Strings(lines)
+    for _, line := range lines {
+        fmt.Fprintf(out, "        line %s: %s\n", line, by_line[line].text(limits))
+    }
+    for _, t := range trains {
+        if p := by_train[t.name]; p != nil {
+            fmt.Fprintf(out, "        train %s: %s\n", t.name, p.text(limits))
+        }
+    }
+    for _, st := range stations {
+        if p := by_station[st.name]; p != nil {
+            fmt.Fprintf(out, "        station %s: %s\n", st.name, p.text(limits))
+        }
+    }
+    var parts []string
+    for _, cause := range delay_causes {
+        if causes[cause] >= time.Minute / 2 {
+            parts = append(parts, fmt.Sprintf("%s %.0f", cause, causes[cause].Minutes()))
+        }
+    }
+    if len(parts) > 0 {
+        fmt.Fprintf(out, "        delay minutes by cause: %s\n", strings.Join(parts, ", "))
+    }
+}
+
+
+/* Passengers */
+
+//traveller waiting at station or sitting in train
+type passenger struct {
+    origin      int //vertex of station
+    destination int
+    appeared    time.Duration
+    boarded     time.Duration
+}
+
+//passengers per hour from one station to another
+type flow struct {
+    origin      int //vertex of station
+    destination int
+    per_hour    float64 //at profile factor 1
+    profile     string
+}
+
+//passenger demand, rate of every flow follows its profile over the day
+type demand struct {
+    flows       []flow
+    profiles    map[string][]float64 //24 factors by hour of day
+}
+
+//built-in profiles:
+//  flat        same demand all day
+//  commuter    night 0-5, morning peak 7-9, off-peak 10-15, evening peak 16-18, evening 19-23
+func new_demand() *demand {
+    d := &demand{profiles: map[string][]float64{}}
+    d.set_profile(PROFILE_FLAT, 0, 23, 1)
+    d.set_profile("commuter", 0, 5, 0.1)
+    d.set_profile("commuter", 6, 6, 1)
+    d.set_profile("commuter", 7, 9, 2.5)
+    d.set_profile("commuter", 10, 15, 0.8)
+    d.set_profile("commuter", 16, 18, 2)
+    d.set_profile("commuter", 19, 21, 0.8)
+    d.set_profile("commuter", 22, 23, 0.3)
+    return d
+}
+
+func builtin_profile(name string) bool {
+    return name == PROFILE_FLAT || name == "commuter"
+}
+
+//factor of hours from - to of profile, new profile has factor 1 in every other hour
+func (d *demand) set_profile(name string, from int, to int, factor float64) {
+    profile, ok := d.profiles[name]
+    if !ok {
+        profile = make([]float64, 24)
+        for h := range profile {
+            profile[h] = 1
+        }
+        d.profiles[name] = profile
+    }
+    for h:=from; h<=to; h++ {
+        profile[h] = factor
+    }
+}
+
+//hours of day written as "7" or "7-9"
+func parse_hours(text string) (int, int, error) {
+    parts := strings.SplitN(text, "-", 2)
+    from, err := strconv.Atoi(parts[0])
+    to := from
+    if err == nil && len(parts) == 2 {
+        to, err = strconv.Atoi(parts[1])
+    }
+    if err != nil || from < 0 || to > 23 || from > to {
+        return 0, 0, fmt.Errorf("hours %q must be an hour 0-23 or a range like 7-9", text)
+    }
+    return from, to, nil
+}
+
+//passengers per hour of flow at hour of day
+func (d *demand) rate(f flow, hour int) float64 {
+    return f.per_hour * d.profiles[f.profile][hour]
+}
+
+//passengers per hour of all flows at hour of day
+func (d *demand) total(hour int) float64 {
+    total := 0.0
+    for _, f := range d.flows {
+        total += d.rate(f, hour)
+    }
+    return total
+}
+
+//true if some train stops at both stations, so passengers need no change
+func direct(trains []train, origin int, destination int) bool {
+    for _, t := range trains {
+        has_origin, has_destination := false, false
+        for _, v := range t.path {
+            has_origin = has_origin || v == origin
+            //one-shot train does not come back
+            has_destination = has_destination || (v == destination && (has_origin || t.service != SERVICE_ONE_SHOT))
+        }
+        if has_origin && has_destination {
+            return true
+        }
+    }
+    return false
+}
+
+//rate passengers per hour at every station, destinations are every station served by a direct train
+func uniform_demand(rate float64, trains []train, stations []station) *demand {
+    d := new_demand()
+    for _, from := range stations {
+        var destinations []int
+        for _, to := range stations {
+            if to.vertex_index != from.vertex_index && direct(trains, from.vertex_index, to.vertex_index) {
+                destinations = append(destinations, to.vertex_index)
+            }
+        }
+        for _, v := range destinations {
+            d.flows = append(d.flows, flow{origin: from.vertex_index, destination: v, per_hour: rate / float64(len(destinations)), profile: PROFILE_FLAT})
+        }
+    }
+    return d
+}
+
+//read demand.txt and profiles.txt of data directory, stations are given by name
+func read_demand(demand_path string, profiles_path string, data input_data, errs *input_errors) *demand {
+    d := new_demand()
+    if _, err := os.Stat(profiles_path); err == nil {
+        const (PROFILE = iota; HOURS; FACTOR)
+        t := read_table(profiles_path, []string{"PROFILE", "HOURS", "FACTOR"}, errs)
+        t.check_count(errs)
+        for _, row := range t.rows {
+            name := t.text(row, PROFILE)
+            if builtin_profile(name) {
+                errs.add(profiles_path, row.line, "profile %s is built in and can not be changed", name)
+                continue
+            }
+            from, to, err := parse_hours(t.text(row, HOURS))
+            if err != nil {
+                errs.add(profiles_path, row.line, "%v", err)
+                continue
+            }
+            factor, err := strconv.ParseFloat(t.text(row, FACTOR), 64)
+            if err != nil || factor < 0 {
+                errs.add(profiles_path, row.line, "FACTOR: bad number %q, must not be negative", t.text(row, FACTOR))
+                continue
+            }
+            d.set_profile(name, from, to, factor)
+        }
+    }
+
+    const (ORIGIN = iota; DESTINATION; PER_HOUR; PROFILE)
+    t := read_table(demand_path, []string{"ORIGIN", "DESTINATION", "PER_HOUR", "PROFILE"}, errs)
+    t.check_count(errs)
+    for _, row := range t.rows {
+        f := flow{per_hour: t.positive(row, PER_HOUR, errs), profile: t.text(row, PROFILE)}
+        if msg := d.check_flow(&f, t.text(row, ORIGIN), t.text(row, DESTINATION), data); msg != "" {
+            errs.add(demand_path, row.line, "%s", msg)
+            continue
+        }
+        d.flows = append(d.flows, f)
+    }
+    return d
+}
+
+//find stations of flow and check that passengers can travel, problem is returned as text
+func (d *demand) check_flow(f *flow, from string, to string, data input_data) string {
+    station_vertex := func(name string) (int, string) {
+        for _, st := range data.stations {
+            if st.name == name {
+                return st.vertex_index, ""
+            }
+        }
+        return 0, fmt.Sprintf("unknown station %q", name)
+    }
+    var msg string
+    if f.origin, msg = station_vertex(from); msg != "" {
+        return msg
+    }
+    if f.destination, msg = station_vertex(to); msg != "" {
+        return msg
+    }
+    if _, ok := d.profiles[f.profile]; !ok {
+        return fmt.Sprintf("unknown profile %q", f.profile)
+    }
+    if f.origin == f.destination {
+        return fmt.Sprintf("origin and destination are both %q", from)
+    }
+    if !direct(data.trains, f.origin, f.destination) {
+        return fmt.Sprintf("no train stops at both %q and %q", from, to)
+    }
+    return ""
+}
+
+//actor putting passengers on platforms, arrivals are a poisson process
+//whose rate changes at every full hour of simulator time
+func start_passengers(ctx context.Context, rng *rand.Rand, d *demand, stations []station, vertex_set []vertex) {
+    for {
+        now := get_current_simulator_time()
+        hour := now.Hour()
+        to_next_hour := now.Truncate(time.Hour).Add(time.Hour).Sub(now)
+        total := d.total(hour)
+
+        //no arrival before next hour, draw again with its rate there
+        gap := to_next_hour
+        if total > 0 {
+            gap = time.Duration(rng.ExpFloat64() / total * float64(time.Hour))
+        }
+        if gap >= to_next_hour {
+            if scheduler.sleep(ctx, to_next_hour) != nil {
+                return
+            }
+            continue
+        }
+        if scheduler.sleep(ctx, gap) != nil {
+            return
+        }
+
+        //flow with chance proportional to its rate
+        x := rng.Float64() * total
+        f := d.flows[len(d.flows)-1]
+        for _, candidate := range d.flows {
+            if x -= d.rate(candidate, hour); x < 0 {
+                f = candidate
+                break
+            }
+        }
+        station_unit := &stations[vertex_set[f.origin].index]
+        station_unit.waiting = append(station_unit.waiting, passenger{origin: f.origin, destination: f.destination, appeared: scheduler.now})
+        count_passenger(station_unit)
+    }
+}
+
+//true if train going on from stage of its route stops at v
+func serves(t *train, stage int, v int) bool {
+    route := t.route()
+    for k:=1; k<len(route); k++ {
+        if t.service == SERVICE_ONE_SHOT && stage+k >= len(route) {
+            break
+        }
+        if route[(stage+k) % len(route)] == v {
+            return true
+        }
+    }
+    return false
+}
+
+//passengers for station v get off train, return how many
+func alight(t *train, v int) int {
+    staying := t.passengers[:0]
+    for _, p := range t.passengers {
+        if p.destination == v {
+            count_trip(p)
+        } else {
+            staying = append(staying, p)
+        }
+    }
+    n := len(t.passengers) - len(staying)
+    t.passengers = staying
+    t.people = len(staying)
+    return n
+}
 
-                repair_vehicle_unit.path = reverse(repair_vehicle_unit.path)
-                send_repair_vehicle(f, -1 ,repair_vehicle_unit, trains, system, rail_switches, vertex_set, stations)
+//waiting passengers whose destination train serves get on while there is room,
+//train is at stage of its path, return how many got on
+func board(t *train, station_unit *station, stage int) int {
+    left := station_unit.waiting[:0]
+    n := 0
+    for _, p := range station_unit.waiting {
+        if t.people < t.capacity && serves(t, stage, p.destination) {
+            p.boarded = scheduler.now
+            t.passengers = append(t.passengers, p)
+            t.people++
+            n++
+        } else {
+            left = append(left, p)
+        }
+    }
+    station_unit.waiting = left
+    stats.boarded += n
+    if t.people > stats.max_load[t.name] {
+        stats.max_load[t.name] = t.people
+    }
+    return n
+}
+
+/* Control console */
+
+const CONSOLE_HELP = `Console commands:
+    pause                           stop simulated time, commands still work
+    resume                          let simulated time run again
+    rate <x>                        time multiplier, 0 = as fast as possible
+    fail railway <from> <to> [repair]
+    fail switch <vertex> [repair]
+    fail platform <station> [repair]
+    fail train <name> [repair]      break asset now, repair is a fixed time like 3h
+    hold <train>                    keep train at its next station
+    release <train>                 let held train go on
+    close <station>                 take a platform out of service
+    open <station>                  open platform closed by close
+    where <train>                   position of train
+    reservations                    every reserved railway and rail switch
+    quit                            stop the simulation
+Vertices are given by name or number, names with spaces only by number.`
+
+//commands typed on stdin while simulation runs, scheduler runs them between
+//two actors so they see and change the same state as actors do
+type console struct {
+    ctx     context.Context
+    rng     *rand.Rand
+    fleet   *dispatcher
+    data    input_data
+    out     io.Writer
+}
 
-                logs(f, "Repair vehicle has ended its job, returned to station at vertex", strconv.Itoa(repair_vehicle_unit.STATION_VERTEX))
-                crash_active = false
+//read commands until quit or end of input
+func (c *console) read(in io.Reader, quit chan bool) {
+    scanner := bufio.NewScanner(in)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" {
+            continue
+        }
+        if line == "quit" || line == "exit" {
+            select {
+                case quit <- true:
+                case <-c.ctx.Done():
+            }
+            return
+        }
+        select {
+            case scheduler.commands <- func() { c.execute(line) }:
+            case <-c.ctx.Done():
+                return
+        }
+    }
+}
 
+//run one command, problems are printed and change nothing
+func (c *console) execute(line string) {
+    args := strings.Fields(line)
+    logged := func() {
+        sim_log.emit(event{Type: EVENT_CONSOLE_COMMAND, Actor: "Console", Detail: line})
+    }
+    need := func(n int) bool {
+        if len(args) < n {
+            fmt.Fprintf(c.out, "console: %s needs more arguments, see help\n", args[0])
+            return false
+        }
+        return true
+    }
 
+    switch args[0] {
+        case "help":
+            fmt.Fprintln(c.out, CONSOLE_HELP)
+        case "pause":
+            scheduler.paused = true
+            logged()
+        case "resume":
+            scheduler.paused = false
+            logged()
+        case "rate":
+            if !need(2) {
+                return
+            }
+            rate, err := strconv.ParseFloat(args[1], 64)
+            if err != nil || rate < 0 {
+                fmt.Fprintf(c.out, "console: rate %q must be a number not less than 0\n", args[1])
+                return
+            }
+            scheduler.time_rate = rate
+            logged()
+        case "fail":
+            if !need(3) {
+                return
+            }
+            r := scenario_incident{At: "0s", Asset: args[1]}
+            rest := args[3:]
+            switch args[1] {
+                case ASSET_RAILWAY:
+                    if !need(4) {
+                        return
+                    }
+                    r.From, r.To, rest = args[2], args[3], args[4:]
+                case "switch", ASSET_RAIL_SWITCH:
+                    r.Asset, r.Vertex = ASSET_RAIL_SWITCH, args[2]
+                case ASSET_PLATFORM:
+                    r.Vertex = args[2]
+                case ASSET_TRAIN:
+                    r.Train = args[2]
+            }
+            if len(rest) > 0 {
+                r.Repair = rest[0]
+            }
+            script, errs := resolve_script("console", []scenario_incident{r}, c.data)
+            for _, e := range errs {
+                fmt.Fprintln(c.out, "console:", strings.TrimPrefix(e.message, "incidents[0]: "))
+            }
+            if len(script) == 0 {
+                return
+            }
+            logged()
+            //breaking railway or switch waits until it is free, so it needs an actor
+            inc := script[0]
+            scheduler.spawn("Console", func() { inject_incident(c.ctx, c.rng, c.fleet, "Console", inc) }).background = true
+        case "hold", "release":
+            if !need(2) {
+                return
+            }
+            t := c.train(args[1])
+            if t == nil {
+                return
+            }
+            if t.held && args[0] == "hold" {
+                fmt.Fprintf(c.out, "console: %s is held already\n", t.name)
+                return
+            }
+            if !t.held && args[0] == "release" {
+                fmt.Fprintf(c.out, "console: %s is not held\n", t.name)
+                return
+            }
+            t.held = !t.held
+            if t.held {
+                scheduler.held++
+            } else {
+                scheduler.held--
+                t.released.send(true)
+            }
+            logged()
+        case "close", "open":
+            if !need(2) {
+                return
+            }
+            st := c.station(args[1])
+            if st == nil {
+                return
+            }
+            if args[0] == "open" {
+                if len(st.console_closed) == 0 {
+                    fmt.Fprintf(c.out, "console: no platform of %s was closed by console\n", st.name)
+                    return
+                }
+                logged()
+                //give back the token of the last close, not of the actor which ran before the console
+                n := len(st.console_closed) - 1
+                st.free_platforms.release_holder(st.console_closed[n])
+                st.console_closed = st.console_closed[:n]
+                st.closed_platforms--
+                e := station_event(EVENT_PLATFORM_OPENED, "Console", st.vertex_index, st.name)
+                e.Detail = fmt.Sprintf("%d of %d platforms still closed by console", len(st.console_closed), st.platforms)
+                sim_log.emit(e)
+                return
+            }
+            if st.closed_platforms == st.platforms {
+                fmt.Fprintf(c.out, "console: every platform of %s is out of service already\n", st.name)
+                return
+            }
+            logged()
+            st.closed_platforms++
+            //platform is taken as soon as no train stands at it
+            scheduler.spawn("Console", func() {
+                if st.free_platforms.acquire(c.ctx) != nil {
+                    return
+                }
+                st.console_closed = append(st.console_closed, scheduler.current)
+                e := station_event(EVENT_PLATFORM_CLOSED, "Console", st.vertex_index, st.name)
+                e.Detail = fmt.Sprintf("%d of %d platforms closed by console", len(st.console_closed), st.platforms)
+                sim_log.emit(e)
+            }).background = true
+        case "where":
+            if !need(2) {
+                return
+            }
+            if t := c.train(args[1]); t != nil {
+                fmt.Fprintln(c.out, c.where(t))
+            }
+        case "reservations":
+            c.reservations()
+        default:
+            fmt.Fprintf(c.out, "console: unknown command %q, see help\n", args[0])
+    }
+}
 
-            case railway_index_1 := <-repair_vehicle_unit.railway_crash:
-                railway_index_2 := <-repair_vehicle_unit.railway_crash
+//train of name, nil after reporting it if there is none
+func (c *console) train(name string) *train {
+    for k := range c.data.trains {
+        if c.data.trains[k].name == name {
+            return &c.data.trains[k]
+        }
+    }
+    fmt.Fprintf(c.out, "console: unknown train %q\n", name)
+    return nil
+}
 
-                logs(f, "Repair vehicle has taken an order to repair railway", strconv.Itoa(railway_index_1),"====",strconv.Itoa(railway_index_2))
+//station of name or vertex number, nil after reporting it if there is none
+func (c *console) station(name string) *station {
+    v, err := find_vertex(name, c.data.stations, c.data.vertex_set, c.data.rail_switches)
+    if err == nil && c.data.vertex_set[v].vertex_type != STATION {
+        err = fmt.Errorf("vertex %q is not a station", name)
+    }
+    if err != nil {
+        fmt.Fprintln(c.out, "console:", err)
+        return nil
+    }
+    return &c.data.stations[c.data.vertex_set[v].index]
+}
 
-                //find path to destination
-                repair_vehicle_unit.path = dijkstra(system, repair_vehicle_unit.STATION_VERTEX, railway_index_1)
-                
-                send_repair_vehicle(f, RAILWAY_REPAIR ,repair_vehicle_unit, trains, system, rail_switches, vertex_set, stations)
-                
-                //repair
-                time.Sleep(time.Duration(RAILWAY_REPAIR_TIME_H*3600000/TIME_RATE) * time.Millisecond)
-                system[railway_index_1][railway_index_2].is_free <- true
-                logs(f, "Repair vehicle has repaired railway", strconv.Itoa(railway_index_1),"====",strconv.Itoa(railway_index_2))
+//where train is right now, position of moving train is counted from its speed
+func (c *console) where(t *train) string {
+    name := func(v int) string {
+        return vertex_name(v, c.data.stations, c.data.vertex_set, c.data.rail_switches)
+    }
+    start, end := t.current_strech[0], t.current_strech[1]
+    position := t.position
+    if t.moving {
+        position += t.kmh * (scheduler.now - t.moving_since).Hours()
+    }
 
-                repair_vehicle_unit.path = reverse(repair_vehicle_unit.path)
-                send_repair_vehicle(f, -1, repair_vehicle_unit, trains, system, rail_switches, vertex_set, stations)
+    at := fmt.Sprintf("on railway %d -> %d, %.1f km from %s", start, end, position, name(start))
+    if position >= c.data.system[start][end].length {
+        at = fmt.Sprintf("at vertex %d (%s)", end, name(end))
+    } else if position <= 0 && !t.moving {
+        at = fmt.Sprintf("at vertex %d (%s), next railway %d -> %d", start, name(start), start, end)
+    }
+    state := "waiting"
+    switch {
+        case t.broken:
+            state = fmt.Sprintf("broken down, incident %d", t.incident)
+        case t.held:
+            state = "held"
+        case t.moving:
+            state = "moving"
+    }
+    return fmt.Sprintf("%s: %s, %s", t.name, at, state)
+}
 
-                logs(f, "Repair vehicle has ended its job, returned to station at vertex", strconv.Itoa(repair_vehicle_unit.STATION_VERTEX))
-                crash_active = false
+//print every taken railway and rail switch token
+func (c *console) reservations() {
+    describe := func(t *sim_semaphore, incident int, on []string) string {
+        parts := append([]string{"reserved"}, on...)
+        if incident != 0 {
+            parts = append(parts, fmt.Sprintf("incident %d", incident))
+        }
+        if len(t.waiting) > 0 {
+            parts = append(parts, fmt.Sprintf("%d waiting", len(t.waiting)))
         }
+        return strings.Join(parts, ", ")
     }
 
+    fmt.Fprintln(c.out, "Reservations at", get_current_simulator_time_as_string())
+    count := 0
+    system := c.data.system
+    for v1:=0; v1<len(system); v1++ {
+        for v2:=0; v2<len(system); v2++ {
+            r := system[v1][v2]
+            if r.is_free == nil || r.is_free.free > 0 {
+                continue
+            }
+            var on []string
+            for _, t := range c.data.trains {
+                if t.current_strech[0] == v1 && t.current_strech[1] == v2 && (t.moving || t.position > 0) {
+                    on = append(on, t.name)
+                }
+            }
+            fmt.Fprintf(c.out, "    railway %d -> %d: %s\n", v1, v2, describe(r.is_free, r.incident, on))
+            count++
+        }
+    }
+    for _, sw := range c.data.rail_switches {
+        if sw.is_free.free > 0 {
+            continue
+        }
+        fmt.Fprintf(c.out, "    rail switch at vertex %d: %s\n", sw.vertex_index, describe(sw.is_free, sw.incident, nil))
+        count++
+    }
+    if count == 0 {
+        fmt.Fprintln(c.out, "    nothing is reserved")
+    }
+}
+
+/* Command line interface */
+
+func default_config() config {
+    return config{
+        data_dir: DATA_DIR,
+        time_rate: TIME_RATE,
+        silent_mode: SILENT_MODE,
+        crash_rate: CRASH_RATE,
+        max_open_incidents: MAX_OPEN_INCIDENTS,
+        duration: SIMULATION_TIME_H * time.Hour,
+        repair_vertex: STATION_VERTEX,
+        repair_speed: REPAIR_VEHICLE_SPEED,
+        dispatch: DISPATCH_NEAREST,
+        rail_switch_repair_time: fixed_distribution(RAIL_SWITCH_REPAIR_TIME_H * time.Hour),
+        railway_repair_time: fixed_distribution(RAILWAY_REPAIR_TIME_H * time.Hour),
+        train_repair_time: fixed_distribution(TRAIN_REPAIR_TIME_H * time.Hour),
+        platform_repair_time: fixed_distribution(PLATFORM_REPAIR_TIME_H * time.Hour),
+        railway_failure: failure_model{unit: USAGE_KM},
+        rail_switch_failure: failure_model{unit: USAGE_ROTATIONS},
+        train_failure: failure_model{unit: USAGE_KM},
+        on_time: thresholds{3 * time.Minute, 5 * time.Minute, 15 * time.Minute},
+    }
 }
-  
 
+//flags shared by every command
+func add_data_flags(fs *flag.FlagSet, cfg *config) {
+    fs.StringVar(&cfg.data_dir, "data", cfg.data_dir, "directory with input data files or scenario file")
+}
 
-//thread function for every train
-func start_train(
-    train_unit train,
-    system [][]railway,
-    stations []station,
-    vertex_set []vertex,
-    rail_switches []rail_switch) {
+//flags of the run command
+func add_run_flags(fs *flag.FlagSet, cfg *config) {
+    add_data_flags(fs, cfg)
+    fs.Float64Var(&cfg.time_rate, "rate", cfg.time_rate, "time multiplier, 3600 -> 1 hour = 1 sec, 0 -> as fast as possible")
+    fs.BoolVar(&cfg.silent_mode, "silent", cfg.silent_mode, "no terminal output")
+    fs.Float64Var(&cfg.crash_rate, "crash-rate", cfg.crash_rate, "chance of a crash every 6 simulated minutes, 0.0 - 1.0, not used with failure models")
+    fs.DurationVar(&cfg.duration, "duration", cfg.duration, "simulated time to run, e.g. 168h, 0 -> no limit")
+    fs.IntVar(&cfg.laps, "laps", cfg.laps, "stop when every train has completed this many laps, 0 -> no limit")
+    fs.IntVar(&cfg.max_crashes, "crashes", cfg.max_crashes, "stop after this many crashes, 0 -> no limit")
+    fs.IntVar(&cfg.max_open_incidents, "max-open-incidents", cfg.max_open_incidents, "random crashes wait while this many incidents are open, 0 -> no limit")
+    fs.Int64Var(&cfg.seed, "seed", cfg.seed, "seed for random values, 0 = pick one from current time")
+    fs.Float64Var(&cfg.passenger_rate, "passengers", cfg.passenger_rate, "passengers per hour appearing at every station, used without demand data, 0 -> no passengers")
+    fs.BoolVar(&cfg.console, "console", cfg.console, "read control commands from stdin instead of stopping on enter, \"help\" lists them")
+    fs.Var(&cfg.on_time, "on-time", "lateness still on time in punctuality report, e.g. 3m,5m,15m")
+    add_repair_flags(fs, cfg)
+    add_failure_flags(fs, cfg)
+}
 
-    //logs file for every train
-    f, _ := os.Create("logs/"+train_unit.name)
-    defer f.Close()
+//failure models of every asset of a type, scenario files can set them for single assets too
+func add_failure_flags(fs *flag.FlagSet, cfg *config) {
+    fs.Var(&cfg.railway_failure, "railway-failure", "failure model of railways, e.g. \"500h,shape=1.5,km=20000\"")
+    fs.Var(&cfg.rail_switch_failure, "switch-failure", "failure model of rail switches, e.g. \"800h,rotations=3000\"")
+    fs.Var(&cfg.train_failure, "train-failure", "failure model of trains, e.g. \"300h,km=50000\"")
+    fs.StringVar(&cfg.incidents_file, "incidents", cfg.incidents_file, "JSON file with scripted incidents, replayed alongside random crashes, add -crash-rate 0 to replay only the script")
+}
 
-    //display logs
-    logs(f, train_unit.name, "has started")
+//repair vehicle flags, scenario files can set them too
+func add_repair_flags(fs *flag.FlagSet, cfg *config) {
+    fs.IntVar(&cfg.repair_vertex, "repair-vertex", cfg.repair_vertex, "vertex of the repair vehicle station")
+    fs.Float64Var(&cfg.repair_speed, "repair-speed", cfg.repair_speed, "max speed of the repair vehicle in kmh")
+    fs.StringVar(&cfg.fleet_spec, "fleet", cfg.fleet_spec, "repair vehicles at depots, e.g. \"12:2,Warszawa:1\", default one at -repair-vertex")
+    fs.StringVar(&cfg.dispatch, "dispatch", cfg.dispatch, "dispatch policy: nearest, eta, priority, round-robin")
+    fs.Var(&cfg.rail_switch_repair_time, "switch-repair", "time to repair a rail switch: 2h, uniform:1h,3h, exp:2h, lognormal:2h,0.5 or hist:1h=2,2h=5,4h=1")
+    fs.Var(&cfg.railway_repair_time, "railway-repair", "time to repair a railway, same forms as -switch-repair")
+    fs.Var(&cfg.train_repair_time, "train-repair", "time to repair a train, same forms as -switch-repair")
+    fs.Var(&cfg.platform_repair_time, "platform-repair", "time to repair a station platform, same forms as -switch-repair")
+}
 
-    i := 0 //actual path stage
-    has_reservation := false
+func usage() {
+    fmt.Fprintln(os.Stderr, `Usage: railway_simulator <command> [flags]
+
+Commands:
+    run         run the simulation (default)
+    validate    check input data and report every problem
+    route       print shortest route between two vertices
+    export      print the network in another format,
+                "export -format scenario" converts a data directory to a scenario file
+
+Run "railway_simulator <command> -h" for flags of a command.
+
+The run command stops on enter, SIGINT or SIGTERM, when a stop condition
+given by flags is met or when trains are deadlocked. With -console stdin
+takes control commands instead of enter, "quit" stops the run.
+
+Passengers come from optional demand.txt (ORIGIN DESTINATION PER_HOUR
+PROFILE, stations by name) and profiles.txt (PROFILE HOURS FACTOR, hours
+like 7-9) in the data directory, or from "demand" of a scenario file.
+Built-in profiles are flat and commuter.
+
+Timetables come from optional timetable.txt (TRAIN RUN STATION ARRIVAL
+DEPARTURE, times like 14:30 or "-") or from "timetable" of a scenario file.
+Run 1 starts at the first vertex of the train path, trains never leave
+before their scheduled departure. The punctuality report at the end of a
+run groups trains by the optional LINE column of trains.txt or "line" of
+a scenario train.
+
+Trains go around their path unless the optional SERVICE column of
+trains.txt or "service" of a scenario train says shuttle (reverse at both
+ends, TURNAROUND or "turnaround_minutes" instead of the station wait time)
+or one-shot (run the path once and end in the depot of the last station).
+Exit codes:
+    0    time limit reached
+    1    bad input data
+    3    every train has completed its laps or ended its run
+    4    crash limit reached
+    5    deadlock
+    130  interrupted`)
+}
 
-    //start traveling, endless loop
-    for{
+//read input data, data_dir is either directory with text files or scenario file
+func load_data(cfg config) (input_data, input_errors) {
+    info, err := os.Stat(cfg.data_dir)
+    if err != nil {
+        return input_data{}, input_errors{{file: cfg.data_dir, message: err.Error()}}
+    }
+    if !info.IsDir() {
+        return load_scenario(cfg.data_dir)
+    }
 
-        //starting and ending vertex
-        start := train_unit.path[i]
-        end := train_unit.path[(i+1) % len(train_unit.path)]
+    system, stations, trains, vertex_set, rail_switches, errs := read_data(
+        filepath.Join(cfg.data_dir, RAILWAYS_FILE),
+        filepath.Join(cfg.data_dir, SYSTEM_FILE),
+        filepath.Join(cfg.data_dir, TRAINS_FILE),
+        filepath.Join(cfg.data_dir, STATIONS_FILE),
+        filepath.Join(cfg.data_dir, VERTEX_SET_FILE),
+        filepath.Join(cfg.data_dir, SWITCHES_FILE))
+    data := input_data{system: system, stations: stations, trains: trains, vertex_set: vertex_set, rail_switches: rail_switches}
+    if _, err := os.Stat(filepath.Join(cfg.data_dir, TIMETABLE_FILE)); err == nil && len(errs) == 0 {
+        data.timetable = read_timetable(filepath.Join(cfg.data_dir, TIMETABLE_FILE), &errs)
+        errs = append(errs, resolve_timetable(filepath.Join(cfg.data_dir, TIMETABLE_FILE), data.timetable, data)...)
+    }
+    if _, err := os.Stat(filepath.Join(cfg.data_dir, DEMAND_FILE)); err == nil {
+        data.demand = read_demand(filepath.Join(cfg.data_dir, DEMAND_FILE), filepath.Join(cfg.data_dir, PROFILES_FILE), data, &errs)
+    }
+    return data, errs
+}
+
+//fill cfg.fleet from -fleet flag, repair vehicles have to start from a station
+func check_depot(cfg *config, data input_data) input_errors {
+    var errs input_errors
+    switch cfg.dispatch {
+        case DISPATCH_NEAREST, DISPATCH_ETA, DISPATCH_PRIORITY, DISPATCH_ROUND_ROBIN:
+        default:
+            errs.add("-dispatch", 0, "unknown dispatch policy %q", cfg.dispatch)
+    }
+    if len(data.vertex_set) == 0 {
+        return errs
+    }
+
+    if cfg.fleet_spec != "" {
+        cfg.fleet = nil
+        for _, part := range strings.Split(cfg.fleet_spec, ",") {
+            name, count := strings.TrimSpace(part), "1"
+            if k := strings.LastIndex(name, ":"); k >= 0 {
+                name, count = name[:k], name[k+1:]
+            }
+            v, err := find_vertex(name, data.stations, data.vertex_set, data.rail_switches)
+            if err != nil {
+                errs.add("-fleet", 0, "%v", err)
+                continue
+            }
+            vehicles, err := strconv.Atoi(count)
+            if err != nil || vehicles < 1 {
+                errs.add("-fleet", 0, "%q: number of vehicles must be at least 1", part)
+                continue
+            }
+            cfg.fleet = append(cfg.fleet, fleet_depot{vertex: v, vehicles: vehicles})
+        }
+    } else if len(cfg.fleet) == 0 {
+        cfg.fleet = []fleet_depot{{vertex: cfg.repair_vertex, vehicles: 1}}
+    }
 
-        if(train_unit.broken){
-            <-train_unit.repaired
+    for _, f := range cfg.fleet {
+        v := f.vertex
+        if v < 0 || v >= len(data.vertex_set) {
+            errs.add(cfg.data_dir, 0, "repair depot vertex %d does not exist", v)
+        } else if data.vertex_set[v].vertex_type != STATION {
+            errs.add(cfg.data_dir, 0, "repair depot vertex %d is not a station", v)
         }
+    }
+    return errs
+}
 
-        train_unit.current_strech[0] = start
-        train_unit.current_strech[1] = end
+//print problems with input data and stop if there are any
+func exit_on_input_errors(errs input_errors) {
+    if len(errs) == 0 {
+        return
+    }
+    for _, e := range errs {
+        fmt.Fprintln(os.Stderr, e)
+    }
+    fmt.Fprintf(os.Stderr, "%d problems found in input data\n", len(errs))
+    os.Exit(EXIT_INPUT_ERROR)
+}
 
-        if !has_reservation{ //if train has reservated this railway before skip waiting for avalibility
-            <-system[start][end].is_free 
+//use repair depot and fleet from scenario for settings not given on command line
+func apply_depot(cfg *config, data input_data, fs *flag.FlagSet) {
+    set := map[string]bool{}
+    fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+    if !set["fleet"] && !set["repair-vertex"] {
+        cfg.fleet = data.fleet
+    }
+    if f := data.failures; f != nil {
+        if !set["railway-failure"] && f.railway != nil {
+            cfg.railway_failure = *f.railway
         }
-           
-        logs(f, train_unit.name, "is now on railway",strconv.Itoa(start),"->",strconv.Itoa(end))
+        if !set["switch-failure"] && f.rail_switch != nil {
+            cfg.rail_switch_failure = *f.rail_switch
+        }
+        if !set["train-failure"] && f.train != nil {
+            cfg.train_failure = *f.train
+        }
+    }
+    depot := data.depot
+    if depot == nil {
+        return
+    }
 
-        //count the needed time to travel and wait
-        real_world_travel_time_in_ms := get_travel_time(system[start][end].length, train_unit.speed, system[start][end].max_speed)
-        in_program_travel_time_in_ms := real_world_travel_time_in_ms / TIME_RATE //fasten time with TIME_RATE multiplier
-        time.Sleep(time.Duration(in_program_travel_time_in_ms) * time.Millisecond)
+    if !set["repair-vertex"] {
+        cfg.repair_vertex = depot.vertex_index
+    }
+    if !set["repair-speed"] && depot.Speed > 0 {
+        cfg.repair_speed = depot.Speed
+    }
+    if !set["switch-repair"] && depot.rail_switch_repair != nil {
+        cfg.rail_switch_repair_time = *depot.rail_switch_repair
+    }
+    if !set["railway-repair"] && depot.railway_repair != nil {
+        cfg.railway_repair_time = *depot.railway_repair
+    }
+    if !set["train-repair"] && depot.train_repair != nil {
+        cfg.train_repair_time = *depot.train_repair
+    }
+    if !set["platform-repair"] && depot.platform_repair != nil {
+        cfg.platform_repair_time = *depot.platform_repair
+    }
+}
 
-        if vertex_set[end].vertex_type == RAIL_SWITCH { //arrived to rail switch
+//human readable name of vertex
+func vertex_name(v int, stations []station, vertex_set []vertex, rail_switches []rail_switch) string {
+    if vertex_set[v].vertex_type == RAIL_SWITCH {
+        if name := rail_switches[vertex_set[v].index].name; name != "" {
+            return name
+        }
+        return "switch " + strconv.Itoa(v)
+    }
+    return stations[vertex_set[v].index].name
+}
 
-            //wait for switch avalibility
-            <-rail_switches[vertex_set[end].index].is_free
+//find vertex by its index or name
+func find_vertex(name string, stations []station, vertex_set []vertex, rail_switches []rail_switch) (int, error) {
+    if v, err := strconv.Atoi(name); err == nil {
+        if v < 0 || v >= len(vertex_set) {
+            return 0, fmt.Errorf("vertex %d out of range 0-%d", v, len(vertex_set)-1)
+        }
+        return v, nil
+    }
+    for v:=0; v<len(vertex_set); v++ {
+        if vertex_name(v, stations, vertex_set, rail_switches) == name {
+            return v, nil
+        }
+    }
+    return 0, fmt.Errorf("unknown vertex %q", name)
+}
 
-            //now train can free used railway
-            system[start][end].is_free <- true
+func run_command(args []string) {
+    fs := flag.NewFlagSet("run", flag.ExitOnError)
+    cfg := default_config()
+    add_run_flags(fs, &cfg)
+    fs.Parse(args)
 
-            //start rotating switch
-            rail_switches[vertex_set[end].index].rotating <- true
+    //get data from files
+    data, errs := load_data(cfg)
+    apply_depot(&cfg, data, fs)
+    errs = append(errs, check_depot(&cfg, data)...)
+    _, script, script_errs := load_script(cfg, data)
+    exit_on_input_errors(append(errs, script_errs...))
+    system, stations, trains, vertex_set, rail_switches := data.system, data.stations, data.trains, data.vertex_set, data.rail_switches
+    settings = cfg
+    settings.demand = data.demand
+    if settings.demand == nil && settings.passenger_rate > 0 {
+        settings.demand = uniform_demand(settings.passenger_rate, trains, stations)
+    }
 
-            logs(f, train_unit.name, "is on railway switch at vertex", strconv.Itoa(end))
+    //seed for random values, print it so the run can be reproduced
+    seed := settings.seed
+    if seed == 0 {
+        seed = time.Now().UTC().UnixNano()
+    }
+    fmt.Println("Seed:", seed)
+    rng := rand.New(rand.NewSource(seed))
+    scheduler = new_event_scheduler(settings.time_rate)
+
+    vehicles := init_fleet()
+    fleet := new_dispatcher(settings.dispatch, vehicles, system, trains, rail_switches, stations, vertex_set)
+    scheduler.after_step = fleet.unblock
+    stats = new_run_summary()
+
+    //simulation is cancelled by SIGINT, SIGTERM and enter or quit of console
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    stop_reason := make(chan string, 1)
+    cons := &console{ctx: ctx, rng: rng, fleet: fleet, data: data, out: os.Stdout}
+    if settings.console {
+        scheduler.commands = make(chan func())
+    }
+    go func() {
+        signals := make(chan os.Signal, 1)
+        signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+        enter := make(chan bool)
+        go func() {
+            if settings.console {
+                cons.read(os.Stdin, enter)
+                return
+            }
+            //closed stdin does not stop scripted runs
+            if _, err := bufio.NewReader(os.Stdin).ReadString('\n'); err == io.EOF {
+                return
+            }
+            enter <- true
+        }()
+        select {
+            case sig := <-signals:
+                stop_reason <- "received " + sig.String()
+            case <-enter:
+                stop_reason <- "stopped by user"
+        }
+        cancel()
+    }()
+    
+    events, err := new_json_sink(EVENTS_LOG)
+    if err != nil {
+        log.Fatal(err)
+    }
+    sim_log = new_logger(terminal_sink{}, events).open(SIMULATOR_LOG)
+    sim_log.emit(event{Type: EVENT_SIMULATOR_STARTED})
 
-            //wait for rotating over
-            <- rail_switches[vertex_set[end].index].rotate_done
+    //I like trains
+    for i:=0; i<len(trains);i++ {
+        //shared with crash and repair vehicle, they see and change the same train
+        train_unit := &trains[i]
+        train_unit.actor = scheduler.spawn(train_unit.name, func() { start_train(ctx, train_unit, trains, system, stations, vertex_set, rail_switches) })
+    }
 
-            //check next railway avalibility before leaving switch
-            next_start := end
-            next_end := train_unit.path[(i+2) % len(train_unit.path)]
-            <-system[next_start][next_end].is_free
-            //next railway avalible, train has reservation now
-            has_reservation = true 
+    //Start switches
+    for i:=0; i<len(rail_switches);i++ {
+        //shared with crash, it counts rotations of switch
+        switch_unit := &rail_switches[i]
+        scheduler.spawn("Rail switch "+strconv.Itoa(switch_unit.vertex_index), func() { start_rail_switch(ctx, switch_unit) })
+    }
 
-            //now train can free used switch
-            rail_switches[vertex_set[end].index].is_free <- true            
+    for i:=0; i<len(vehicles); i++ {
+        repair_vehicle_unit := vehicles[i]
+        repair_vehicle_unit.actor = scheduler.spawn(repair_vehicle_unit.name, func() { start_repair_vehicle(ctx, repair_vehicle_unit, fleet, trains, system, rail_switches, vertex_set, stations) })
+    }
 
-        } else { //arrived to station
+    scheduler.spawn("Crash", func() { crash(ctx, rng, fleet, trains, system, rail_switches) }).background = true
+    if settings.demand != nil {
+        //own random source, so passengers do not change crashes of a seed
+        passenger_rng := rand.New(rand.NewSource(seed + 1))
+        scheduler.spawn("Passengers", func() { start_passengers(ctx, passenger_rng, settings.demand, stations, vertex_set) }).background = true
+    }
+    for k := range script {
+        inc := script[k]
+        scheduler.spawn("Incident script", func() { start_incident(ctx, rng, fleet, inc) }).background = true
+    }
 
-            //wait for avalible platform
-            <-stations[vertex_set[end].index].free_platforms
-            //now train can free used railway
-            system[start][end].is_free <- true
-            
-            logs(f, train_unit.name, "has arrived to station", stations[vertex_set[end].index].name)
+    //run simulation until time is up, a stop condition is met or it is cancelled
+    stats.trains = len(trains)
+    scheduler.run(ctx, settings.duration)
+    select {
+        case stats.end_reason = <-stop_reason:
+            stats.exit_code = EXIT_INTERRUPTED
+        default:
+            if scheduler.end_reason != "" {
+                stats.end_reason, stats.exit_code = scheduler.end_reason, scheduler.exit_code
+            } else {
+                stats.end_reason, stats.exit_code = "time limit reached", EXIT_TIME_LIMIT
+            }
+    }
 
-            //count the needed time to wait at platform
-            wait_time_in_ms := stations[vertex_set[end].index].wait_time * 60000 / TIME_RATE
-            time.Sleep(time.Millisecond * time.Duration(wait_time_in_ms))
+    //let every actor stop and close its log
+    cancel()
+    scheduler.shutdown()
+    sim_log.emit(event{Type: EVENT_SIMULATOR_ENDED, Detail: stats.end_reason})
+    if err := sim_log.close(); err != nil {
+        fmt.Fprintln(os.Stderr, "Cannot write simulator log:", err)
+    }
+    if err := events.close(); err != nil {
+        fmt.Fprintln(os.Stderr, "Cannot write event log:", err)
+    }
+    print_summary(os.Stdout, trains, stations, system, rail_switches)
+    os.Exit(stats.exit_code)
+}
 
-            //TODO: get people from platform
+//counters for summary at the end of run
+type run_summary struct {
+    stretches   map[string]int //railways travelled by every train
+    stops       map[string]int //station stops of every train
+    laps        map[string]int //completed laps of every train
+    trains      int
+    trains_done int            //trains which have completed settings.laps
+    finished    int            //one-shot trains in depot
+    crashes     int
+    repairs     int
+    incidents   map[int]*incident_record //by incident id
+    max_open    int                      //most incidents open at the same time
+    unreachable int                      //orders dispatched again because vehicle had no route
+    depot_cut_offs int
+    appeared    int            //passengers
+    boarded     int
+    delivered   int
+    waited      time.Duration  //on platform, sum over delivered passengers
+    travelled   time.Duration  //on train, sum over delivered passengers
+    max_queue   map[string]int //by station
+    max_load    map[string]int //by train
+    schedule    []late_record  //every scheduled time trains have reached
+    end_reason  string
+    exit_code   int
+}
 
-            logs(f, train_unit.name, "is ready to leave the station", stations[vertex_set[end].index].name)
-            
-            //check next railway before leaving station
-            next_start := end
-            next_end := train_unit.path[(i+2) % len(train_unit.path)]
-            <-system[next_start][next_end].is_free
-            has_reservation = true 
+func new_run_summary() *run_summary {
+    return &run_summary{stretches: map[string]int{}, stops: map[string]int{}, laps: map[string]int{}, incidents: map[int]*incident_record{}, max_queue: map[string]int{}, max_load: map[string]int{}}
+}
 
-            stations[vertex_set[end].index].free_platforms <- true 
+//one crash from failure to repair, times are simulated time since start
+type incident_record struct {
+    asset       string
+    crashed     time.Duration
+    dispatched  time.Duration //repair vehicle took the order
+    vehicle     string
+    repaired    time.Duration
+    open        bool
+}
 
-            logs(f, train_unit.name, "has left the station", stations[vertex_set[end].index].name)
+//scheduled arrival or departure of train compared to timetable
+type late_record struct {
+    train       string
+    line        string
+    station     string
+    kind        string //SCHEDULE_ARRIVAL or SCHEDULE_DEPARTURE
+    late        time.Duration //negative = early
+    causes      map[string]time.Duration //delay split by CAUSE_*
+    stop        bool //counted in punctuality, arrival or departure of stop without arrival
+}
 
+//incidents which are not repaired yet
+func (r *run_summary) open_incidents() int {
+    open := 0
+    for _, inc := range r.incidents {
+        if inc.open {
+            open++
         }
+    }
+    return open
+}
 
-        //next stage
-        i = (i+1) % len(train_unit.path)
+//count new crash and return its incident id, stop when crash limit is reached
+func count_crash(asset string) int {
+    stats.crashes++
+    id := stats.crashes
+    stats.incidents[id] = &incident_record{asset: asset, crashed: scheduler.now, open: true}
+    if open := stats.open_incidents(); open > stats.max_open {
+        stats.max_open = open
     }
+    if settings.max_crashes > 0 && stats.crashes >= settings.max_crashes {
+        scheduler.finish(strconv.Itoa(stats.crashes) + " crashes", EXIT_CRASH_LIMIT)
+    }
+    return id
 }
 
+//close incident after repair
+func count_repair(id int) {
+    stats.repairs++
+    stats.incidents[id].repaired = scheduler.now
+    stats.incidents[id].open = false
+}
 
-func main() {
+//new passenger waiting at station
+func count_passenger(station_unit *station) {
+    stats.appeared++
+    if len(station_unit.waiting) > stats.max_queue[station_unit.name] {
+        stats.max_queue[station_unit.name] = len(station_unit.waiting)
+    }
+}
 
-    //seed for random values
-    rand.Seed(time.Now().UTC().UnixNano())
+//passenger has reached destination
+func count_trip(p passenger) {
+    stats.delivered++
+    stats.waited += p.boarded - p.appeared
+    stats.travelled += scheduler.now - p.boarded
+}
 
-    //get data from files
-    system, stations, trains, vertex_set, rail_switches := read_data(RAILWAYS_PATH, SYSTEM_PATH, TRAINS_PATH, STATIONS_PATH, VERTEX_SET_PATH, SWITCHES_PATH)
-    repair_vehicle_unit := init_repair_vehicle(repair_vehicle{})
-    
-    logs(nil, "Simulator started")
+//train has reached scheduled time of station
+func count_late(r late_record) {
+    stats.schedule = append(stats.schedule, r)
+}
 
-    //I like trains
-    for i:=0; i<len(trains);i++ {
-        go start_train(trains[i], system, stations, vertex_set, rail_switches)
+//one-shot train has ended its run, it is done with its laps too,
+//stop when no train runs any more
+func count_finished(name string) {
+    stats.finished++
+    if settings.laps > 0 && stats.laps[name] < settings.laps {
+        stats.trains_done++
+    }
+    if stats.finished == stats.trains {
+        scheduler.finish("every train has ended its run", EXIT_LAPS_DONE)
+    } else if settings.laps > 0 && stats.trains_done == stats.trains {
+        scheduler.finish("every train has completed " + strconv.Itoa(settings.laps) + " laps or ended its run", EXIT_LAPS_DONE)
     }
+}
 
-    //Start switches
-    for i:=0; i<len(rail_switches);i++ {
-        go start_rail_switch(rail_switches[i])
+//count lap of train, stop when every train has done its laps
+func count_lap(name string) {
+    stats.laps[name]++
+    if settings.laps > 0 && stats.laps[name] == settings.laps {
+        stats.trains_done++
+        if stats.trains_done == stats.trains {
+            scheduler.finish("every train has completed " + strconv.Itoa(settings.laps) + " laps", EXIT_LAPS_DONE)
+        }
+    }
+}
+
+func print_summary(out *os.File, trains []train, stations []station, system [][]railway, rail_switches []rail_switch) {
+    fmt.Fprintln(out, "Simulation summary")
+    fmt.Fprintf(out, "    simulated time: %v (%s - %s)\n", scheduler.now, start_time.Format("2006-01-02 15:04"), get_current_simulator_time_as_string())
+    fmt.Fprintf(out, "    ended:          %s\n", stats.end_reason)
+    fmt.Fprintf(out, "    crashes:        %d\n", stats.crashes)
+    fmt.Fprintf(out, "    repairs done:   %d\n", stats.repairs)
+    fmt.Fprintf(out, "    incidents:      %d open at the end, at most %d at once\n", stats.open_incidents(), stats.max_open)
+    var waited, repaired time.Duration
+    for _, inc := range stats.incidents {
+        if !inc.open {
+            waited += inc.dispatched - inc.crashed
+            repaired += inc.repaired - inc.crashed
+        }
+    }
+    if stats.repairs > 0 {
+        n := time.Duration(stats.repairs)
+        fmt.Fprintf(out, "    mean wait for repair vehicle: %v, mean time to repair: %v\n", (waited / n).Round(time.Minute), (repaired / n).Round(time.Minute))
+    }
+    jobs := map[string]int{}
+    for _, inc := range stats.incidents {
+        if !inc.open {
+            jobs[inc.vehicle]++
+        }
+    }
+    for _, f := range settings.fleet {
+        fmt.Fprintf(out, "    repair vehicles at vertex %d: %d\n", f.vertex, f.vehicles)
+    }
+    if stats.unreachable > 0 || stats.depot_cut_offs > 0 {
+        fmt.Fprintf(out, "    unreachable orders: %d, depots cut off: %d times\n", stats.unreachable, stats.depot_cut_offs)
+    }
+    if len(jobs) > 1 {
+        names := make([]string, 0, len(jobs))
+        for name := range jobs {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        for _, name := range names {
+            fmt.Fprintf(out, "    %s: %d repairs\n", name, jobs[name])
+        }
+    }
+    for _, t := range trains {
+        fmt.Fprintf(out, "    %s: %d laps, %d railways, %d station stops", t.name, stats.laps[t.name], stats.stretches[t.name], stats.stops[t.name])
+        if t.finished {
+            fmt.Fprint(out, ", ended its run")
+        }
+        if settings.demand != nil {
+            fmt.Fprintf(out, ", %d passengers on board, at most %d of %d", t.people, stats.max_load[t.name], t.capacity)
+        }
+        fmt.Fprintln(out)
+    }
+    if settings.demand != nil {
+        fmt.Fprintf(out, "    passengers:     %d appeared, %d boarded, %d arrived\n", stats.appeared, stats.boarded, stats.delivered)
+        if stats.delivered > 0 {
+            n := time.Duration(stats.delivered)
+            fmt.Fprintf(out, "    mean wait on platform: %v, mean time on train: %v\n", (stats.waited / n).Round(time.Minute), (stats.travelled / n).Round(time.Minute))
+        }
+        for _, st := range stations {
+            fmt.Fprintf(out, "    %s: %d waiting, at most %d\n", st.name, len(st.waiting), stats.max_queue[st.name])
+        }
+    }
+
+    print_punctuality(out, trains, stations)
+
+    //every asset which has failed, age and usage are counted from its last repair
+    if stats.crashes == 0 {
+        return
+    }
+    fmt.Fprintln(out, "    failure history:")
+    history := func(name string, h asset_health, unit string) {
+        if len(h.history) == 0 {
+            return
+        }
+        var age time.Duration
+        usage := 0.0
+        ids := make([]string, len(h.history))
+        for k, r := range h.history {
+            age += r.age
+            usage += r.usage
+            ids[k] = strconv.Itoa(r.incident)
+        }
+        n := len(h.history)
+        fmt.Fprintf(out, "        %s: %d failures, mean %v and %.0f %s since repair, incidents %s\n", name, n, (age / time.Duration(n)).Round(time.Minute), usage / float64(n), unit, strings.Join(ids, " "))
+    }
+    for v1:=0; v1<len(system); v1++ {
+        for v2:=0; v2<len(system); v2++ {
+            history(fmt.Sprintf("railway %d -> %d", v1, v2), system[v1][v2].health, USAGE_KM)
+        }
     }
+    for _, sw := range rail_switches {
+        history(fmt.Sprintf("rail switch at vertex %d", sw.vertex_index), sw.health, USAGE_ROTATIONS)
+    }
+    for _, t := range trains {
+        history(t.name, t.health, USAGE_KM)
+    }
+}
 
- 
-    go start_repair_vehicle(repair_vehicle_unit, trains, system, rail_switches, vertex_set, stations)
+func validate_command(args []string) {
+    fs := flag.NewFlagSet("validate", flag.ExitOnError)
+    cfg := default_config()
+    add_data_flags(fs, &cfg)
+    add_repair_flags(fs, &cfg)
+    add_failure_flags(fs, &cfg)
+    fs.Parse(args)
+
+    data, errs := load_data(cfg)
+    apply_depot(&cfg, data, fs)
+    errs = append(errs, check_depot(&cfg, data)...)
+    _, script, script_errs := load_script(cfg, data)
+    exit_on_input_errors(append(errs, script_errs...))
+    flows := 0
+    if data.demand != nil {
+        flows = len(data.demand.flows)
+    }
+    fmt.Printf("%s: ok, %d vertices, %d stations, %d rail switches, %d trains, %d scripted incidents, %d demand flows, %d timetable stops\n", cfg.data_dir, len(data.vertex_set), len(data.stations), len(data.rail_switches), len(data.trains), len(script), flows, len(data.timetable))
+}
 
-    go crash(repair_vehicle_unit, trains, system, rail_switches)
+func route_command(args []string) {
+    fs := flag.NewFlagSet("route", flag.ExitOnError)
+    cfg := default_config()
+    add_data_flags(fs, &cfg)
+    fs.Usage = func() {
+        fmt.Fprintln(os.Stderr, "Usage: railway_simulator route [flags] FROM TO\nFROM and TO are vertex indexes or station names")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    if fs.NArg() != 2 {
+        fs.Usage()
+        os.Exit(2)
+    }
 
+    data, errs := load_data(cfg)
+    exit_on_input_errors(errs)
+    system, stations, vertex_set, rail_switches := data.system, data.stations, data.vertex_set, data.rail_switches
+    from, err := find_vertex(fs.Arg(0), stations, vertex_set, rail_switches)
+    if err != nil {
+        log.Fatal(err)
+    }
+    to, err := find_vertex(fs.Arg(1), stations, vertex_set, rail_switches)
+    if err != nil {
+        log.Fatal(err)
+    }
 
-    //wait for user input to end simulator
-    fmt.Scanln()
-    logs(nil, "Simulator end")
+    path := dijkstra(system, from, to, nil)
+    if path == nil {
+        log.Fatalf("no route from %s to %s", fs.Arg(0), fs.Arg(1))
+    }
+    length := route_length(system, path)
+    names := make([]string, len(path))
+    for i:=0; i<len(path); i++ {
+        names[i] = fmt.Sprintf("%s (%d)", vertex_name(path[i], stations, vertex_set, rail_switches), path[i])
+    }
+    fmt.Println(strings.Join(names, " -> "))
+    fmt.Printf("%.0f km\n", length)
 }
 
+func export_command(args []string) {
+    fs := flag.NewFlagSet("export", flag.ExitOnError)
+    cfg := default_config()
+    add_data_flags(fs, &cfg)
+    add_repair_flags(fs, &cfg)
+    add_failure_flags(fs, &cfg)
+    format := fs.String("format", "dot", "output format: dot, scenario")
+    output := fs.String("o", "", "output file, default stdout")
+    fs.Parse(args)
+
+    data, errs := load_data(cfg)
+    apply_depot(&cfg, data, fs)
+    errs = append(errs, check_depot(&cfg, data)...)
+    raw, _, script_errs := load_script(cfg, data)
+    exit_on_input_errors(append(errs, script_errs...))
+    data.incidents = raw
+
+    out := os.Stdout
+    if *output != "" {
+        f, err := os.Create(*output)
+        if err != nil {
+            log.Fatal(err)
+        }
+        defer f.Close()
+        out = f
+    }
 
+    switch *format {
+        case "dot":
+            export_dot(out, data)
+        case "scenario":
+            if err := export_scenario(out, data, cfg); err != nil {
+                log.Fatal(err)
+            }
+        default:
+            log.Fatalf("unknown export format %q", *format)
+    }
+}
 
+//write network as Graphviz graph
+func export_dot(out *os.File, data input_data) {
+    system, vertex_set := data.system, data.vertex_set
+    fmt.Fprintln(out, "digraph railway {")
+    for v:=0; v<len(vertex_set); v++ {
+        shape := "box"
+        if vertex_set[v].vertex_type == RAIL_SWITCH {
+            shape = "diamond"
+        }
+        fmt.Fprintf(out, "    %d [label=%q shape=%s];\n", v, vertex_name(v, data.stations, vertex_set, data.rail_switches), shape)
+    }
+    for v1:=0; v1<len(system); v1++ {
+        for v2:=0; v2<len(system); v2++ {
+            if system[v1][v2].is_free != nil {
+                fmt.Fprintf(out, "    %d -> %d [label=\"%.0f km, %.0f km/h\"];\n", v1, v2, system[v1][v2].length, system[v1][v2].max_speed)
+            }
+        }
+    }
+    fmt.Fprintln(out, "}")
+}
 
 
+func main() {
+    command := "run"
+    args := os.Args[1:]
+    if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+        command = args[0]
+        args = args[1:]
+    }
 
+    switch command {
+        case "run":
+            run_command(args)
+        case "validate":
+            validate_command(args)
+        case "route":
+            route_command(args)
+        case "export":
+            export_command(args)
+        case "help":
+            usage()
+        default:
+            fmt.Fprintln(os.Stderr, "Unknown command", command)
+            usage()
+            os.Exit(2)
+    }
+}
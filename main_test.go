@@ -0,0 +1,1164 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "math"
+    "math/rand"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+//set in environment of child process which runs the simulator instead of tests
+const RUN_SIMULATOR_ENV = "RAILWAY_SIMULATOR_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+    if os.Getenv(RUN_SIMULATOR_ENV) == "1" {
+        main()
+        os.Exit(0)
+    }
+    os.Exit(m.Run())
+}
+
+//output and exit code of one simulator command
+type simulator_result struct {
+    stdout  string
+    stderr  string
+    code    int
+    dir     string //working directory, logs are written there
+}
+
+//run simulator command in its own process and directory, so logs and os.Exit
+//of the run do not touch the test process or the repository
+func run_simulator(t *testing.T, args ...string) simulator_result {
+    t.Helper()
+    dir := t.TempDir()
+    cmd := exec.Command(os.Args[0], args...)
+    cmd.Dir = dir
+    cmd.Env = append(os.Environ(), RUN_SIMULATOR_ENV + "=1")
+    var stdout, stderr bytes.Buffer
+    cmd.Stdout, cmd.Stderr = &stdout, &stderr
+    err := cmd.Run()
+    code := 0
+    if exit, ok := err.(*exec.ExitError); ok {
+        code = exit.ExitCode()
+    } else if err != nil {
+        t.Fatalf("cannot run simulator: %v", err)
+    }
+    return simulator_result{stdout: stdout.String(), stderr: stderr.String(), code: code, dir: dir}
+}
+
+//absolute path of file in repository, simulator runs in another directory
+func repo_path(t *testing.T, name string) string {
+    t.Helper()
+    path, err := filepath.Abs(name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+//event log of finished run
+func read_events(t *testing.T, r simulator_result) []byte {
+    t.Helper()
+    content, err := os.ReadFile(filepath.Join(r.dir, LOGS_DIR, EVENTS_LOG))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return content
+}
+
+//scenario file with content in a directory of the test
+func write_scenario(t *testing.T, content string) string {
+    t.Helper()
+    file := filepath.Join(t.TempDir(), "scenario.json")
+    if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+        t.Fatal(err)
+    }
+    return file
+}
+
+//fresh scheduler, log, stats and settings for a test which calls simulator code directly,
+//those of the package are put back when the test ends
+func use_globals(t *testing.T) {
+    saved_scheduler, saved_log, saved_stats, saved_settings := scheduler, sim_log, stats, settings
+    t.Cleanup(func() {
+        scheduler, sim_log, stats, settings = saved_scheduler, saved_log, saved_stats, saved_settings
+    })
+    scheduler = new_event_scheduler(0)
+    sim_log = new_logger()
+    stats = new_run_summary()
+    settings = default_config()
+}
+
+//same seed and input give a byte-identical event log
+func TestRunIsDeterministicForSeed(t *testing.T) {
+    args := []string{"run", "-data", repo_path(t, DATA_DIR), "-rate", "0", "-silent", "-seed", "42", "-duration", "168h"}
+    first := run_simulator(t, args...)
+    second := run_simulator(t, args...)
+    if first.code != second.code {
+        t.Fatalf("exit codes differ: %d and %d", first.code, second.code)
+    }
+    a, b := read_events(t, first), read_events(t, second)
+    if len(a) == 0 {
+        t.Fatal("event log is empty")
+    }
+    if !bytes.Equal(a, b) {
+        t.Fatal("event logs of two runs with seed 42 differ")
+    }
+
+    other := run_simulator(t, "run", "-data", repo_path(t, DATA_DIR), "-rate", "0", "-silent", "-seed", "43", "-duration", "168h")
+    if bytes.Equal(a, read_events(t, other)) {
+        t.Fatal("seeds 42 and 43 give the same event log")
+    }
+}
+
+//any whitespace separates tokens, # starts a comment
+func TestTokenize(t *testing.T) {
+    tests := []struct {
+        line    string
+        want    []string
+    }{
+        {"Intercity_1 200 100", []string{"Intercity_1", "200", "100"}},
+        {"\t0  1\t150 ", []string{"0", "1", "150"}},
+        {"0 1 150 # main line", []string{"0", "1", "150"}},
+        {"4#comment", []string{"4"}},
+        {"# comment only", nil},
+        {"   ", nil},
+    }
+    for _, tt := range tests {
+        if got := tokenize(tt.line); fmt.Sprint(got) != fmt.Sprint(tt.want) || len(got) != len(tt.want) {
+            t.Errorf("tokenize(%q) = %q, want %q", tt.line, got, tt.want)
+        }
+    }
+}
+
+//columns are found in any order and case, optional ones may be left out
+func TestReadHeader(t *testing.T) {
+    columns := []string{"NAME", "SPEED", "LINE?"}
+    tests := []struct {
+        header  string
+        pos     []int //nil if header is rejected
+        err     string
+    }{
+        {"NAME SPEED LINE", []int{0, 1, 2}, ""},
+        {"speed name", []int{1, 0, -1}, ""},
+        {"LINE Speed NAME", []int{2, 1, 0}, ""},
+        {"NAME", nil, "header has no SPEED column"},
+        {"NAME SPEED COLOUR", nil, "unknown column COLOUR"},
+    }
+    for _, tt := range tests {
+        var errs input_errors
+        tab := table{path: "trains.txt", columns: columns}
+        tab.read_header(tokenize(tt.header), 2, &errs)
+        if fmt.Sprint(tab.pos) != fmt.Sprint(tt.pos) {
+            t.Errorf("%q: positions %v, want %v", tt.header, tab.pos, tt.pos)
+        }
+        if tt.err == "" && len(errs) > 0 || tt.err != "" && (len(errs) != 1 || errs[0].message != tt.err || errs[0].line != 2) {
+            t.Errorf("%q: errors %v, want %q", tt.header, errs, tt.err)
+        }
+    }
+}
+
+//values of rows are read by column name, whatever order the header has
+func TestReadTableColumnOrder(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "trains.txt")
+    content := "3\nSPEED NAME\n100 Intercity_1\n\n# slow one\n90 Intercity_3\n120\n"
+    if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+        t.Fatal(err)
+    }
+    var errs input_errors
+    tab := read_table(path, []string{"NAME", "SPEED", "LINE?"}, &errs)
+    tab.check_count(&errs)
+    var got []string
+    for _, row := range tab.rows {
+        got = append(got, tab.text(row, 0) + ":" + tab.text(row, 1) + ":" + tab.text(row, 2))
+    }
+    if want := "[Intercity_1:100: Intercity_3:90:]"; fmt.Sprint(got) != want {
+        t.Errorf("rows %v, want %s", got, want)
+    }
+    //short row is skipped and reported at its line, count matches the 3 data lines
+    if len(errs) != 1 || errs[0].line != 7 || !strings.Contains(errs[0].message, "expected 2 columns (SPEED NAME), got 1") {
+        t.Errorf("errors %v, want short row at line 7", errs)
+    }
+}
+
+//committed scenario.json is the export of input_data and exports back to itself
+func TestScenarioRoundTrip(t *testing.T) {
+    committed, err := os.ReadFile("scenario.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    legacy := run_simulator(t, "export", "-data", repo_path(t, DATA_DIR), "-format", "scenario")
+    if legacy.code != 0 {
+        t.Fatalf("export of %s failed with exit code %d: %s", DATA_DIR, legacy.code, legacy.stderr)
+    }
+    if legacy.stdout != string(committed) {
+        t.Fatalf("scenario.json is stale, regenerate it with export -data %s -format scenario", DATA_DIR)
+    }
+    again := run_simulator(t, "export", "-data", repo_path(t, "scenario.json"), "-format", "scenario")
+    if again.code != 0 {
+        t.Fatalf("export of scenario.json failed with exit code %d: %s", again.code, again.stderr)
+    }
+    if again.stdout != legacy.stdout {
+        t.Fatal("exporting scenario.json does not give scenario.json back")
+    }
+}
+
+//problems of scenario are reported at JSON path and line of the value
+func TestScenarioErrorsHaveJSONPath(t *testing.T) {
+    content, err := os.ReadFile("scenario.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    lines := index_json(content)
+    if lines.line("trains[2].path[3]") <= lines.line("trains[2]") {
+        t.Fatalf("trains[2].path[3] is on line %d, before its train on line %d", lines.line("trains[2].path[3]"), lines.line("trains[2]"))
+    }
+    if lines.line("trains[2].no_such_field") != lines.line("trains[2]") {
+        t.Fatal("left out value does not get line of its entry")
+    }
+
+    var doc scenario_file
+    if err := json.Unmarshal(content, &doc); err != nil {
+        t.Fatal(err)
+    }
+    doc.Trains[2].Speed = -1
+    bad, err := json.MarshalIndent(doc, "", "    ")
+    if err != nil {
+        t.Fatal(err)
+    }
+    path := filepath.Join(t.TempDir(), "bad.json")
+    if err := os.WriteFile(path, bad, 0644); err != nil {
+        t.Fatal(err)
+    }
+    r := run_simulator(t, "validate", "-data", path)
+    if r.code != EXIT_INPUT_ERROR {
+        t.Fatalf("validate of bad scenario exits with %d, want %d", r.code, EXIT_INPUT_ERROR)
+    }
+    want := fmt.Sprintf("%s:%d: trains[2].speed: ", path, index_json(bad).line("trains[2].speed"))
+    if !strings.Contains(r.stderr, want) {
+        t.Fatalf("problem is not reported as %q:\n%s", want, r.stderr)
+    }
+}
+
+//scenario without rail switches validates and runs, random crashes pick railways and trains only
+func TestScenarioWithoutSwitches(t *testing.T) {
+    file := write_scenario(t, `{
+    "vertices": [
+        {"name": "A", "type": "station"},
+        {"name": "B", "type": "station"},
+        {"name": "Depot", "type": "station"}
+    ],
+    "edges": [
+        {"from": "A", "to": "B", "max_speed": 100, "length": 100},
+        {"from": "B", "to": "A", "max_speed": 100, "length": 100},
+        {"from": "B", "to": "Depot", "max_speed": 100, "length": 10},
+        {"from": "Depot", "to": "B", "max_speed": 100, "length": 10}
+    ],
+    "stations": [
+        {"vertex": "A", "platforms": 1, "depots": 1, "wait_time_minutes": 5},
+        {"vertex": "B", "platforms": 1, "depots": 1, "wait_time_minutes": 5},
+        {"vertex": "Depot", "platforms": 1, "depots": 1, "wait_time_minutes": 1}
+    ],
+    "trains": [
+        {"name": "Local", "capacity": 100, "speed": 100, "path": ["A", "B"]}
+    ],
+    "repair_depot": {"vertex": "Depot"}
+}`)
+    if r := run_simulator(t, "validate", "-data", file); r.code != 0 {
+        t.Fatalf("validate exits with %d:\n%s%s", r.code, r.stdout, r.stderr)
+    }
+    r := run_simulator(t, "run", "-data", file, "-rate", "0", "-silent", "-seed", "1", "-duration", "48h", "-crash-rate", "1")
+    if r.code != EXIT_TIME_LIMIT {
+        t.Fatalf("run exits with %d, want %d:\n%s", r.code, EXIT_TIME_LIMIT, r.stderr)
+    }
+    if laps_done(t, r)["Local"] == 0 {
+        t.Errorf("Local completes no lap:\n%s", r.stdout)
+    }
+}
+
+//incident times are clock times on the first day they come after start, dates or durations since start,
+//assets are found by name
+func TestResolveScript(t *testing.T) {
+    data, errs := load_scenario(repo_path(t, "scenario.json"))
+    if len(errs) > 0 {
+        t.Fatal(errs)
+    }
+    train := func(at string) scenario_incident {
+        return scenario_incident{At: at, Asset: ASSET_TRAIN, Train: "Intercity_1"}
+    }
+    tests := []struct {
+        name    string
+        inc     scenario_incident
+        at      time.Duration
+        err     string //part of error, empty if incident is fine
+    }{
+        {"clock after start", train("14:30"), 2*time.Hour + 30*time.Minute, ""},
+        {"clock before start is next day", train("09:00"), 21 * time.Hour, ""},
+        {"clock of start", train("12:00"), 0, ""},
+        {"date", train("2017-01-02 12:00"), 24 * time.Hour, ""},
+        {"duration", train("26h30m"), 26*time.Hour + 30*time.Minute, ""},
+        {"date before start", train("2016-12-31 12:00"), 0, "incidents[0].at: time \"2016-12-31 12:00\" is before start"},
+        {"no time", train("noon"), 0, "incidents[0].at: time \"noon\" is neither"},
+        {"railway", scenario_incident{At: "1h", Asset: ASSET_RAILWAY, From: "Gdynia", To: "Gdansk"}, time.Hour, ""},
+        {"missing railway", scenario_incident{At: "1h", Asset: ASSET_RAILWAY, From: "Gdynia", To: "Krakow"}, 0, "incidents[0].to: railway"},
+        {"switch", scenario_incident{At: "1h", Asset: ASSET_RAIL_SWITCH, Vertex: "switch 5"}, time.Hour, ""},
+        {"station is no switch", scenario_incident{At: "1h", Asset: ASSET_RAIL_SWITCH, Vertex: "Gdynia"}, 0, "incidents[0].vertex: vertex \"Gdynia\" has no"},
+        {"unknown train", scenario_incident{At: "1h", Asset: ASSET_TRAIN, Train: "Pendolino"}, 0, "incidents[0].train: unknown train"},
+        {"unknown asset", scenario_incident{At: "1h", Asset: "bridge"}, 0, "incidents[0].asset: unknown asset"},
+    }
+    for _, tt := range tests {
+        tt.inc.at = "incidents[0]"
+        script, errs := resolve_script("scenario.json", []scenario_incident{tt.inc}, data)
+        if tt.err != "" {
+            if len(errs) != 1 || !strings.Contains(errs[0].message, tt.err) {
+                t.Errorf("%s: errors %v, want one with %q", tt.name, errs, tt.err)
+            }
+            continue
+        }
+        if len(errs) > 0 || len(script) != 1 {
+            t.Errorf("%s: errors %v", tt.name, errs)
+            continue
+        }
+        if script[0].at != tt.at {
+            t.Errorf("%s: at %v, want %v", tt.name, script[0].at, tt.at)
+        }
+    }
+}
+
+//scripted incidents happen at their time without random crashes and get repaired
+func TestIncidentScriptReplay(t *testing.T) {
+    file := filepath.Join(t.TempDir(), "incidents.json")
+    script := `[
+    {"at": "2017-01-02 09:00", "asset": "train", "train": "Intercity_2", "repair": "30m"},
+    {"at": "14:30", "asset": "rail_switch", "vertex": "switch 5", "repair": "1h"}
+]`
+    if err := os.WriteFile(file, []byte(script), 0644); err != nil {
+        t.Fatal(err)
+    }
+    r := run_simulator(t, "run", "-data", repo_path(t, DATA_DIR), "-rate", "0", "-silent", "-seed", "1", "-duration", "48h", "-crash-rate", "0", "-incidents", file)
+    if r.code != EXIT_TIME_LIMIT {
+        t.Fatalf("run exits with %d, want %d:\n%s%s", r.code, EXIT_TIME_LIMIT, r.stdout, r.stderr)
+    }
+    var crashes []string
+    repaired := map[int]bool{}
+    for _, line := range bytes.Split(bytes.TrimSpace(read_events(t, r)), []byte("\n")) {
+        var e event
+        if err := json.Unmarshal(line, &e); err != nil {
+            t.Fatal(err)
+        }
+        switch e.Type {
+            case EVENT_CRASH:
+                crashes = append(crashes, fmt.Sprint(e.Time.Format("2006-01-02 15:04"), " ", e.Asset, " ", e.Incident))
+            case EVENT_REPAIR_COMPLETED:
+                repaired[e.Incident] = true
+        }
+    }
+    want := []string{"2017-01-01 14:30 rail_switch 1", "2017-01-02 09:00 train 2"}
+    if fmt.Sprint(crashes) != fmt.Sprint(want) {
+        t.Errorf("crashes %v, want %v", crashes, want)
+    }
+    if !repaired[1] || !repaired[2] {
+        t.Errorf("repaired incidents %v, want 1 and 2", repaired)
+    }
+}
+
+//every form of repair time parses to its kind and mean, bad ones are rejected
+func TestParseDistribution(t *testing.T) {
+    tests := []struct {
+        text    string
+        kind    string
+        mean    time.Duration
+        err     string //part of error, empty if text is fine
+    }{
+        {"2h", DIST_FIXED, 2 * time.Hour, ""},
+        {"uniform:1h,3h", DIST_UNIFORM, 2 * time.Hour, ""},
+        {"uniform: 1h , 1h", DIST_UNIFORM, time.Hour, ""},
+        {"exp:90m", DIST_EXPONENTIAL, 90 * time.Minute, ""},
+        {"lognormal:2h,0", DIST_LOGNORMAL, 2 * time.Hour, ""},
+        {"hist:1h=1,3h=1", DIST_HISTOGRAM, 2 * time.Hour, ""},
+        {"hist:1h=3,5h=1", DIST_HISTOGRAM, 2 * time.Hour, ""},
+        {"two hours", "", 0, "invalid duration"},
+        {"-1h", "", 0, "negative duration"},
+        {"uniform:3h,1h", "", 0, "upper bound 1h0m0s is less than lower bound 3h0m0s"},
+        {"uniform:1h", "", 0, "uniform needs 2 values, got 1"},
+        {"exp:1h,2h", "", 0, "exp needs 1 values, got 2"},
+        {"lognormal:2h,-1", "", 0, "negative sigma"},
+        {"hist:1h,2h=1", "", 0, "bin \"1h\" is not duration=weight"},
+        {"hist:1h=0", "", 0, "histogram weights sum to 0"},
+        {"normal:2h", "", 0, "unknown distribution \"normal\""},
+    }
+    for _, tt := range tests {
+        d, err := parse_distribution(tt.text)
+        if tt.err != "" {
+            if err == nil || !strings.Contains(err.Error(), tt.err) {
+                t.Errorf("%q: error %v, want %q", tt.text, err, tt.err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%q: %v", tt.text, err)
+            continue
+        }
+        if d.kind != tt.kind || d.mean() != tt.mean {
+            t.Errorf("%q: %s with mean %v, want %s with mean %v", tt.text, d.kind, d.mean(), tt.kind, tt.mean)
+        }
+    }
+}
+
+//draws stay within bounds of distribution and average out at its mean
+func TestDistributionDraw(t *testing.T) {
+    const draws = 20000
+    tests := []struct {
+        text    string
+        min     time.Duration
+        max     time.Duration //0 = no upper bound
+    }{
+        {"2h", 2 * time.Hour, 2 * time.Hour},
+        {"uniform:1h,3h", time.Hour, 3 * time.Hour},
+        {"exp:2h", 0, 0},
+        {"lognormal:2h,0.5", 0, 0},
+        {"hist:1h=1,2h=2,4h=1", time.Hour, 4 * time.Hour},
+    }
+    for _, tt := range tests {
+        d, err := parse_distribution(tt.text)
+        if err != nil {
+            t.Fatal(err)
+        }
+        rng := rand.New(rand.NewSource(1))
+        var sum time.Duration
+        for k := 0; k < draws; k++ {
+            v := d.draw(rng)
+            if v < tt.min || tt.max > 0 && v > tt.max {
+                t.Fatalf("%q: draw %v out of %v - %v", tt.text, v, tt.min, tt.max)
+            }
+            if d.kind == DIST_HISTOGRAM && v != time.Hour && v != 2 * time.Hour && v != 4 * time.Hour {
+                t.Fatalf("%q: draw %v is no bin", tt.text, v)
+            }
+            sum += v
+        }
+        mean := sum / draws
+        if diff := math.Abs(float64(mean - d.mean())); diff > 0.03 * float64(d.mean()) {
+            t.Errorf("%q: mean of draws %v, want about %v", tt.text, mean, d.mean())
+        }
+    }
+}
+
+//hours of a profile are one hour of day or a range within a day
+func TestParseHours(t *testing.T) {
+    tests := []struct {
+        text    string
+        from    int
+        to      int
+        ok      bool
+    }{
+        {"7", 7, 7, true},
+        {"7-9", 7, 9, true},
+        {"0-23", 0, 23, true},
+        {"9-7", 0, 0, false},
+        {"22-24", 0, 0, false},
+        {"-1", 0, 0, false},
+        {"morning", 0, 0, false},
+        {"7-", 0, 0, false},
+    }
+    for _, tt := range tests {
+        from, to, err := parse_hours(tt.text)
+        if (err == nil) != tt.ok || from != tt.from || to != tt.to {
+            t.Errorf("parse_hours(%q) = %d, %d, %v, want %d, %d, ok %v", tt.text, from, to, err, tt.from, tt.to, tt.ok)
+        }
+    }
+}
+
+//rate of flow follows factor of its profile by hour, new profiles are 1 outside of their hours
+func TestDemandProfiles(t *testing.T) {
+    d := new_demand()
+    d.set_profile("school", 7, 8, 3)
+    d.set_profile("school", 13, 13, 0)
+    d.flows = []flow{{per_hour: 10, profile: PROFILE_FLAT}, {per_hour: 4, profile: "commuter"}, {per_hour: 2, profile: "school"}}
+    tests := []struct {
+        hour    int
+        rates   []float64
+    }{
+        {3, []float64{10, 0.4, 2}},
+        {8, []float64{10, 10, 6}},
+        {13, []float64{10, 3.2, 0}},
+        {17, []float64{10, 8, 2}},
+        {23, []float64{10, 1.2, 2}},
+    }
+    for _, tt := range tests {
+        total := 0.0
+        for k, f := range d.flows {
+            if got := d.rate(f, tt.hour); math.Abs(got - tt.rates[k]) > 1e-9 {
+                t.Errorf("hour %d: rate of %s flow %v, want %v", tt.hour, f.profile, got, tt.rates[k])
+            }
+            total += tt.rates[k]
+        }
+        if got := d.total(tt.hour); math.Abs(got - total) > 1e-9 {
+            t.Errorf("hour %d: total %v, want %v", tt.hour, got, total)
+        }
+    }
+}
+
+//flows of demand.txt are checked against stations, profiles and trains
+func TestReadDemand(t *testing.T) {
+    data, errs := load_scenario(repo_path(t, "scenario.json"))
+    if len(errs) > 0 {
+        t.Fatal(errs)
+    }
+    dir := t.TempDir()
+    profiles := filepath.Join(dir, "profiles.txt")
+    demand_file := filepath.Join(dir, "demand.txt")
+    write := func(path string, content string) {
+        if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    write(profiles, "4\nPROFILE HOURS FACTOR\nschool 7-8 3\nschool 25 1\nflat 7 2\nschool 9 -1\n")
+    write(demand_file, `6
+ORIGIN DESTINATION PER_HOUR PROFILE
+Gdynia Lodz 30 school
+Lodz Gdynia 20 commuter
+Gdynia Sopot 5 flat
+Gdynia Lodz 5 weekend
+Lodz Lodz 5 flat
+Gdynia Repair_Station 5 flat
+`)
+    errs = nil
+    d := read_demand(demand_file, profiles, data, &errs)
+
+    var flows []string
+    for _, f := range d.flows {
+        flows = append(flows, fmt.Sprint(f.origin, "->", f.destination, " ", f.per_hour, " ", f.profile))
+    }
+    if want := "[0->4 30 school 4->0 20 commuter]"; fmt.Sprint(flows) != want {
+        t.Errorf("flows %v, want %s", flows, want)
+    }
+    if got := d.rate(d.flows[0], 7); got != 90 {
+        t.Errorf("school flow at 7 has rate %v, want 90", got)
+    }
+
+    want := []string{
+        "profiles.txt:4: hours \"25\" must be an hour 0-23 or a range like 7-9",
+        "profiles.txt:5: profile flat is built in and can not be changed",
+        "profiles.txt:6: FACTOR: bad number \"-1\", must not be negative",
+        "demand.txt:5: unknown station \"Sopot\"",
+        "demand.txt:6: unknown profile \"weekend\"",
+        "demand.txt:7: origin and destination are both \"Lodz\"",
+        "demand.txt:8: no train stops at both \"Gdynia\" and \"Repair_Station\"",
+    }
+    var got []string
+    for _, e := range errs {
+        got = append(got, fmt.Sprintf("%s:%d: %s", filepath.Base(e.file), e.line, e.message))
+    }
+    if strings.Join(got, "\n") != strings.Join(want, "\n") {
+        t.Errorf("errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+    }
+}
+
+//passengers of -passengers go to every station of a direct train in equal shares
+func TestUniformDemand(t *testing.T) {
+    data, errs := load_scenario(repo_path(t, "scenario.json"))
+    if len(errs) > 0 {
+        t.Fatal(errs)
+    }
+    d := uniform_demand(60, data.trains, data.stations)
+    per_station := map[int]float64{}
+    for _, f := range d.flows {
+        if !direct(data.trains, f.origin, f.destination) || f.profile != PROFILE_FLAT {
+            t.Errorf("flow %+v has no direct train or is not flat", f)
+        }
+        per_station[f.origin] += f.per_hour
+    }
+    for _, st := range data.stations {
+        want := 60.0
+        if st.name == "Repair_Station" {
+            want = 0
+        }
+        if math.Abs(per_station[st.vertex_index] - want) > 1e-9 {
+            t.Errorf("%s: %v passengers per hour, want %v", st.name, per_station[st.vertex_index], want)
+        }
+    }
+}
+
+//clock times are on the first day where they are not before the previous time of the train,
+//so a timetable runs on past midnight
+func TestParseSchedule(t *testing.T) {
+    tests := []struct {
+        text        string
+        previous    time.Duration
+        want        time.Duration
+        err         string //part of error, empty if time is fine
+    }{
+        {"14:30", 0, 2*time.Hour + 30*time.Minute, ""},
+        {"12:00", 0, 0, ""},
+        {"09:00", 0, 21 * time.Hour, ""},
+        {"23:50", 2 * time.Hour, 11*time.Hour + 50*time.Minute, ""},
+        {"00:10", 11*time.Hour + 50*time.Minute, 12*time.Hour + 10*time.Minute, ""},
+        {"12:00", 24 * time.Hour, 24 * time.Hour, ""},
+        {"11:00", 25 * time.Hour, 47 * time.Hour, ""},
+        {"2017-01-02 01:00", 0, 13 * time.Hour, ""},
+        {"2017-01-02 01:00", 14 * time.Hour, 0, "is before previous time of train"},
+        {"25:00", 0, 0, "is neither"},
+        {"noon", 0, 0, "is neither"},
+    }
+    for _, tt := range tests {
+        got, err := parse_schedule(tt.text, tt.previous)
+        if tt.err != "" {
+            if err == nil || !strings.Contains(err.Error(), tt.err) {
+                t.Errorf("parse_schedule(%q, %v): error %v, want %q", tt.text, tt.previous, err, tt.err)
+            }
+            continue
+        }
+        if err != nil || got != tt.want {
+            t.Errorf("parse_schedule(%q, %v) = %v, %v, want %v", tt.text, tt.previous, got, err, tt.want)
+        }
+    }
+}
+
+//stops are matched to the next visit of their station in the run, times roll over midnight
+func TestResolveTimetable(t *testing.T) {
+    data, errs := load_scenario(repo_path(t, "scenario.json"))
+    if len(errs) > 0 {
+        t.Fatal(errs)
+    }
+    stop := func(line int, run int, station string, arrival string, departure string) scenario_stop {
+        return scenario_stop{Train: "Intercity_1", Run: run, Station: station, Arrival: arrival, Departure: departure, line: line}
+    }
+    raw := []scenario_stop{
+        stop(3, 1, "Gdynia", "", "12:05"),
+        stop(4, 1, "Lodz", "23:50", "00:10"),
+        stop(5, 1, "Wroclaw", "02:00", ""),
+        stop(6, 2, "Gdynia", "09:00", "09:10"),
+        stop(7, 3, "Gdynia", "2017-01-02 08:00", ""),
+        stop(8, 2, "Lodz", "", "12:00"),
+        stop(9, 3, "Krakow", "", "12:00"),
+        stop(10, 3, "Lodz", "", ""),
+        stop(11, 4, "Gdynia", "10:00", ""),
+        {Train: "Pendolino", Run: 1, Station: "Gdynia", Departure: "12:00", line: 12},
+    }
+    errs = resolve_timetable("timetable.txt", raw, data)
+
+    var train_unit train
+    for _, tr := range data.trains {
+        if tr.name == "Intercity_1" {
+            train_unit = tr
+        }
+    }
+    h := func(hours float64) time.Duration { return time.Duration(hours * float64(time.Hour)) }
+    want := []scheduled_stop{
+        {run: 1, stage: 0, arrival: -1, departure: 5 * time.Minute},
+        {run: 1, stage: 1, arrival: h(11) + 50*time.Minute, departure: h(12) + 10*time.Minute},
+        {run: 1, stage: 2, arrival: h(14), departure: -1},
+        {run: 2, stage: 0, arrival: h(21), departure: h(21) + 10*time.Minute},
+        {run: 4, stage: 0, arrival: h(22), departure: -1},
+    }
+    if fmt.Sprint(train_unit.timetable) != fmt.Sprint(want) {
+        t.Errorf("timetable %v, want %v", train_unit.timetable, want)
+    }
+
+    want_errs := []string{
+        "timetable.txt:7: arrival: time \"2017-01-02 08:00\" is before previous time of train",
+        "timetable.txt:8: run 2 of Intercity_1 comes after run 3",
+        "timetable.txt:9: Intercity_1 does not stop at \"Krakow\" later in run 3",
+        "timetable.txt:10: stop at \"Lodz\" needs an arrival or a departure",
+        "timetable.txt:12: unknown train \"Pendolino\"",
+    }
+    var got []string
+    for _, e := range errs {
+        got = append(got, fmt.Sprintf("%s:%d: %s", e.file, e.line, e.message))
+    }
+    if strings.Join(got, "\n") != strings.Join(want_errs, "\n") {
+        t.Errorf("errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want_errs, "\n"))
+    }
+}
+
+//circular and one-shot trains follow their path, shuttles come back the same way without repeating the ends
+func TestTrainRoute(t *testing.T) {
+    tests := []struct {
+        service string
+        path    []int
+        want    []int
+    }{
+        {SERVICE_CIRCULAR, []int{0, 4, 8, 3}, []int{0, 4, 8, 3}},
+        {SERVICE_ONE_SHOT, []int{0, 4, 8, 3}, []int{0, 4, 8, 3}},
+        {SERVICE_SHUTTLE, []int{0, 4, 8, 3}, []int{0, 4, 8, 3, 8, 4}},
+        {SERVICE_SHUTTLE, []int{0, 4}, []int{0, 4}},
+    }
+    for _, tt := range tests {
+        tr := train{service: tt.service, path: tt.path}
+        if got := tr.route(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+            t.Errorf("%s %v: route %v, want %v", tt.service, tt.path, got, tt.want)
+        }
+    }
+}
+
+//railways needed by a service: back to the start for circular, both ways for shuttle, none after the end for one-shot
+func TestMissingEdge(t *testing.T) {
+    //0 <-> 1 <-> 2, and 2 -> 3 one way
+    system := make([][]railway, 4)
+    for v := range system {
+        system[v] = make([]railway, 4)
+    }
+    for _, e := range [][2]int{{0, 1}, {1, 0}, {1, 2}, {2, 1}, {2, 3}} {
+        system[e[0]][e[1]] = railway{max_speed: 100, length: 10, is_free: new_sim_semaphore(1)}
+    }
+    tests := []struct {
+        service string
+        path    []int
+        missing string //"v1->v2", empty if every railway exists
+    }{
+        {SERVICE_CIRCULAR, []int{0, 1, 2, 1}, ""},
+        {SERVICE_CIRCULAR, []int{0, 1, 2}, "2->0"},
+        {SERVICE_SHUTTLE, []int{0, 1, 2}, ""},
+        {SERVICE_SHUTTLE, []int{1, 2, 3}, "3->2"},
+        {SERVICE_ONE_SHOT, []int{0, 1, 2, 3}, ""},
+        {SERVICE_ONE_SHOT, []int{3, 2}, "3->2"},
+    }
+    for _, tt := range tests {
+        v1, v2, ok := missing_edge(train{service: tt.service, path: tt.path}, system)
+        got := ""
+        if !ok {
+            got = fmt.Sprint(v1, "->", v2)
+        }
+        if got != tt.missing {
+            t.Errorf("%s %v: missing %q, want %q", tt.service, tt.path, got, tt.missing)
+        }
+    }
+}
+
+//shuttles turn around at stations, one-shot trains end in a depot
+func TestCheckService(t *testing.T) {
+    //station with depot, rail switch, station without depot
+    vertex_set := []vertex{{vertex_type: STATION, index: 0}, {vertex_type: RAIL_SWITCH, index: 0}, {vertex_type: STATION, index: 1}}
+    stations := []station{{name: "Depot", free_depots: new_sim_semaphore(1)}, {name: "Halt", free_depots: new_sim_semaphore(0)}}
+    tests := []struct {
+        service     string
+        path        []int
+        turnaround  float64
+        err         string //part of problem, empty if there is none
+    }{
+        {SERVICE_CIRCULAR, []int{0, 1, 2}, 0, ""},
+        {SERVICE_CIRCULAR, []int{1, 0}, 0, ""},
+        {SERVICE_SHUTTLE, []int{0, 1, 2}, 5, ""},
+        {SERVICE_SHUTTLE, []int{0, 1}, 0, "shuttle has to start and end at stations"},
+        {SERVICE_SHUTTLE, []int{1, 2}, 0, "shuttle has to start and end at stations"},
+        {SERVICE_ONE_SHOT, []int{2, 1, 0}, 0, ""},
+        {SERVICE_ONE_SHOT, []int{0, 1, 2}, 0, "one-shot train has to end at a station with a depot"},
+        {SERVICE_ONE_SHOT, []int{0, 1}, 0, "one-shot train has to end at a station with a depot"},
+        {"express", []int{0, 1, 2}, 0, "unknown service \"express\""},
+        {SERVICE_SHUTTLE, []int{0, 1, 2}, -1, "turnaround must not be negative"},
+    }
+    for _, tt := range tests {
+        got := check_service(train{service: tt.service, path: tt.path, turnaround: tt.turnaround}, vertex_set, stations)
+        if tt.err == "" && got != "" || !strings.Contains(got, tt.err) {
+            t.Errorf("%s %v: problem %q, want %q", tt.service, tt.path, got, tt.err)
+        }
+    }
+}
+
+//shuttle goes back and forth along its path, one-shot train runs it once and finishes
+func TestShuttleAndOneShotRuns(t *testing.T) {
+    file := write_scenario(t, `{
+    "vertices": [
+        {"name": "A", "type": "station"},
+        {"name": "B", "type": "station"},
+        {"name": "C", "type": "station"}
+    ],
+    "edges": [
+        {"from": "A", "to": "B", "max_speed": 100, "length": 100},
+        {"from": "B", "to": "A", "max_speed": 100, "length": 100},
+        {"from": "B", "to": "C", "max_speed": 100, "length": 100},
+        {"from": "C", "to": "B", "max_speed": 100, "length": 100}
+    ],
+    "stations": [
+        {"vertex": "A", "platforms": 1, "depots": 1, "wait_time_minutes": 5},
+        {"vertex": "B", "platforms": 2, "depots": 1, "wait_time_minutes": 5},
+        {"vertex": "C", "platforms": 1, "depots": 1, "wait_time_minutes": 5}
+    ],
+    "trains": [
+        {"name": "Shuttle", "capacity": 100, "speed": 100, "path": ["A", "B", "C"], "service": "shuttle", "turnaround_minutes": 10},
+        {"name": "Once", "capacity": 100, "speed": 100, "path": ["C", "B", "A"], "service": "one-shot"}
+    ],
+    "repair_depot": {"vertex": "B"}
+}`)
+    r := run_simulator(t, "run", "-data", file, "-rate", "0", "-silent", "-seed", "1", "-duration", "12h", "-crash-rate", "0")
+    if r.code != EXIT_TIME_LIMIT {
+        t.Fatalf("run exits with %d, want %d:\n%s%s", r.code, EXIT_TIME_LIMIT, r.stdout, r.stderr)
+    }
+    edges := map[string][]string{}
+    finished := map[string]bool{}
+    for _, line := range bytes.Split(bytes.TrimSpace(read_events(t, r)), []byte("\n")) {
+        var e event
+        if err := json.Unmarshal(line, &e); err != nil {
+            t.Fatal(err)
+        }
+        switch e.Type {
+            case EVENT_TRAIN_ENTERED_EDGE:
+                edges[e.Actor] = append(edges[e.Actor], e.Edge)
+            case EVENT_TRAIN_FINISHED:
+                finished[e.Actor] = true
+        }
+    }
+    if got := strings.Join(edges["Once"], " "); got != "2->1 1->0" || !finished["Once"] {
+        t.Errorf("one-shot train drives %q, finished %v, want \"2->1 1->0\" and finished", got, finished["Once"])
+    }
+    shuttle := strings.Join(edges["Shuttle"], " ")
+    if !strings.HasPrefix(shuttle, "0->1 1->2 2->1 1->0 0->1 1->2") || finished["Shuttle"] {
+        t.Errorf("shuttle drives %q, finished %v", shuttle, finished["Shuttle"])
+    }
+}
+
+//trains waiting for each other are a deadlock even while other actors still move
+func TestDeadlockedFindsWaitCycle(t *testing.T) {
+    a := &actor{name: "Intercity_1", waiting: true}
+    b := &actor{name: "Intercity_2", waiting: true}
+    c := &actor{name: "Intercity_3"}
+    first := &sim_semaphore{holders: []*actor{b}, waiting: []*actor{a}}
+    second := &sim_semaphore{holders: []*actor{a}, waiting: []*actor{b}}
+    a.blocked_on, b.blocked_on = first, second
+    s := &event_scheduler{actors: []*actor{a, b, c}}
+
+    if reason := s.deadlocked(); reason != "deadlock, Intercity_1, Intercity_2 wait for each other" {
+        t.Fatalf("cycle of two trains gives reason %q", reason)
+    }
+    second.holders = []*actor{c}
+    if reason := s.deadlocked(); reason != "" {
+        t.Fatalf("train waiting for moving train is reported as %q", reason)
+    }
+    c.waiting = true
+    if reason := s.deadlocked(); reason != "deadlock, no train can move" {
+        t.Fatalf("every train waiting gives reason %q", reason)
+    }
+}
+
+//train crashed while waiting for a switch, platform or railway halts right there
+func TestBrokenTrainHaltsAtOnce(t *testing.T) {
+    for seed := 1; seed <= 3; seed++ {
+        r := run_simulator(t, "run", "-data", repo_path(t, DATA_DIR), "-rate", "0", "-silent", "-seed", fmt.Sprint(seed), "-duration", "168h")
+        var events []event
+        for _, line := range bytes.Split(bytes.TrimSpace(read_events(t, r)), []byte("\n")) {
+            var e event
+            if err := json.Unmarshal(line, &e); err != nil {
+                t.Fatal(err)
+            }
+            events = append(events, e)
+        }
+        for k, e := range events {
+            if e.Type != EVENT_CRASH || e.Asset != ASSET_TRAIN {
+                continue
+            }
+            for _, next := range events[k+1:] {
+                if next.Actor != e.Target {
+                    continue
+                }
+                if next.Type != EVENT_TRAIN_BROKE_DOWN && next.Type != EVENT_TRAIN_STOPPED {
+                    t.Errorf("seed %d: %s crashed at %s but went on with %s", seed, e.Target, e.Time, next.Type)
+                }
+                break
+            }
+        }
+    }
+}
+
+//laps per train from the summary of a finished run
+func laps_done(t *testing.T, r simulator_result) map[string]int {
+    t.Helper()
+    laps := map[string]int{}
+    for _, m := range regexp.MustCompile(`(?m)^ +(\S+): (\d+) laps,`).FindAllStringSubmatch(r.stdout, -1) {
+        laps[m[1]], _ = strconv.Atoi(m[2])
+    }
+    if len(laps) == 0 {
+        t.Fatalf("summary lists no trains:\n%s", r.stdout)
+    }
+    return laps
+}
+
+//default crash rate with one open incident at a time leaves every train running laps
+func TestDefaultRunMakesProgress(t *testing.T) {
+    for seed := 1; seed <= 5; seed++ {
+        r := run_simulator(t, "run", "-data", repo_path(t, DATA_DIR), "-rate", "0", "-silent", "-seed", fmt.Sprint(seed), "-duration", "168h")
+        for name, n := range laps_done(t, r) {
+            if n == 0 {
+                t.Errorf("seed %d: %s completes no lap in 168h", seed, name)
+            }
+        }
+    }
+}
+
+//repair vehicle waiting behind trains which wait for a broken railway used to deadlock with them,
+//with several incidents open at once repairs have to go on and every train has to keep moving
+func TestRepairVehicleDoesNotDeadlock(t *testing.T) {
+    const hours = 336
+    r := run_simulator(t, "run", "-data", repo_path(t, DATA_DIR), "-rate", "0", "-silent", "-seed", "7", "-duration", fmt.Sprint(hours, "h"), "-crash-rate", "0.01", "-max-open-incidents", "0")
+    if r.code != EXIT_TIME_LIMIT {
+        t.Fatalf("seed 7 with crash rate 0.01 exits with %d, want %d:\n%s", r.code, EXIT_TIME_LIMIT, r.stdout)
+    }
+    repairs := 0
+    last_moved := map[string]time.Time{}
+    for _, line := range bytes.Split(bytes.TrimSpace(read_events(t, r)), []byte("\n")) {
+        var e event
+        if err := json.Unmarshal(line, &e); err != nil {
+            t.Fatal(err)
+        }
+        switch e.Type {
+            case EVENT_REPAIR_COMPLETED:
+                repairs++
+            case EVENT_TRAIN_ENTERED_EDGE:
+                last_moved[e.Actor] = e.Time
+        }
+    }
+    if repairs < 10 {
+        t.Errorf("%d repairs completed in %dh, want at least 10", repairs, hours)
+    }
+    last_day := start_time.Add((hours - 24) * time.Hour)
+    for name := range laps_done(t, r) {
+        if last_moved[name].Before(last_day) {
+            t.Errorf("%s stands still since %v", name, last_moved[name])
+        }
+    }
+
+    for seed := 1; seed <= 10; seed++ {
+        r := run_simulator(t, "run", "-data", repo_path(t, DATA_DIR), "-rate", "0", "-silent", "-seed", fmt.Sprint(seed), "-duration", "168h", "-max-open-incidents", "0")
+        if r.code == EXIT_DEADLOCK {
+            t.Errorf("seed %d deadlocks with any number of open incidents", seed)
+        }
+    }
+}
+
+//order of a site vehicle can not reach is dispatched again, and vehicle without a way back
+//to its depot starts the next job from where it stands
+func TestUnreachableOrdersAreRetried(t *testing.T) {
+    //Depot -> A is one way, C - D can not be reached from Depot, A - B not from C
+    file := write_scenario(t, `{
+    "vertices": [
+        {"name": "A", "type": "station"},
+        {"name": "B", "type": "station"},
+        {"name": "Depot", "type": "station"},
+        {"name": "C", "type": "station"},
+        {"name": "D", "type": "station"}
+    ],
+    "edges": [
+        {"from": "A", "to": "B", "max_speed": 100, "length": 100},
+        {"from": "B", "to": "A", "max_speed": 100, "length": 100},
+        {"from": "Depot", "to": "A", "max_speed": 100, "length": 100},
+        {"from": "C", "to": "D", "max_speed": 100, "length": 100},
+        {"from": "D", "to": "C", "max_speed": 100, "length": 100}
+    ],
+    "stations": [
+        {"vertex": "A", "platforms": 1, "depots": 1, "wait_time_minutes": 5},
+        {"vertex": "B", "platforms": 1, "depots": 1, "wait_time_minutes": 5},
+        {"vertex": "Depot", "platforms": 1, "depots": 1, "wait_time_minutes": 1},
+        {"vertex": "C", "platforms": 1, "depots": 1, "wait_time_minutes": 5},
+        {"vertex": "D", "platforms": 1, "depots": 1, "wait_time_minutes": 5}
+    ],
+    "trains": [
+        {"name": "Local", "capacity": 100, "speed": 100, "path": ["A", "B"]}
+    ],
+    "repair_depot": {"vertex": "Depot"},
+    "incidents": [
+        {"at": "1h", "asset": "railway", "from": "D", "to": "C", "repair": "1h"},
+        {"at": "5h", "asset": "railway", "from": "A", "to": "B", "repair": "1h"},
+        {"at": "10h", "asset": "railway", "from": "B", "to": "A", "repair": "1h"}
+    ]
+}`)
+    //round-robin gives each incident first to the vehicle which can not reach it
+    r := run_simulator(t, "run", "-data", file, "-rate", "0", "-silent", "-seed", "1", "-duration", "48h", "-crash-rate", "0", "-fleet", "Depot:1,C:1", "-dispatch", DISPATCH_ROUND_ROBIN)
+    if r.code != EXIT_TIME_LIMIT {
+        t.Fatalf("run exits with %d, want %d:\n%s", r.code, EXIT_TIME_LIMIT, r.stdout)
+    }
+    repaired := map[int]bool{}
+    from_depot := 0
+    for _, line := range bytes.Split(bytes.TrimSpace(read_events(t, r)), []byte("\n")) {
+        var e event
+        if err := json.Unmarshal(line, &e); err != nil {
+            t.Fatal(err)
+        }
+        if e.Type == EVENT_REPAIR_COMPLETED {
+            repaired[e.Incident] = true
+        }
+        if e.Type == EVENT_VEHICLE_ENTERED_EDGE && e.Edge == "2->0" {
+            from_depot++
+        }
+    }
+    for incident := 1; incident <= 3; incident++ {
+        if !repaired[incident] {
+            t.Errorf("incident %d is not repaired", incident)
+        }
+    }
+    if from_depot != 1 {
+        t.Errorf("vehicle left Depot %d times, want 1, it stays at A after the first job", from_depot)
+    }
+}
+
+//incidents of orders sent to vehicle, in order
+func assigned(vehicle *repair_vehicle) []int {
+    var incidents []int
+    for _, item := range vehicle.orders.items {
+        incidents = append(incidents, item.(repair_order).incident)
+    }
+    return incidents
+}
+
+//every dispatch policy sends orders to the vehicle it promises
+func TestDispatcherPolicies(t *testing.T) {
+    use_globals(t)
+    settings.repair_speed = 100
+    settings.railway_repair_time = fixed_distribution(10 * time.Hour)
+    settings.platform_repair_time = fixed_distribution(time.Hour)
+
+    //stations 0 - 1 - 2 in a line, 1h of driving from one end to the other, depots at both ends
+    network := func(policy string) (*dispatcher, *repair_vehicle, *repair_vehicle) {
+        system := make([][]railway, 3)
+        for v := range system {
+            system[v] = make([]railway, 3)
+        }
+        for v := 0; v < 2; v++ {
+            system[v][v+1] = railway{max_speed: 100, length: 50, is_free: new_sim_semaphore(1)}
+            system[v+1][v] = railway{max_speed: 100, length: 50, is_free: new_sim_semaphore(1)}
+        }
+        var stations []station
+        var vertex_set []vertex
+        for v := 0; v < 3; v++ {
+            stations = append(stations, station{name: fmt.Sprint("Station ", v), free_platforms: new_sim_semaphore(1), vertex_index: v})
+            vertex_set = append(vertex_set, vertex{vertex_type: STATION, index: v})
+        }
+        first, second := init_repair_vehicle("Repair Vehicle 1", 0), init_repair_vehicle("Repair Vehicle 2", 2)
+        return new_dispatcher(policy, []*repair_vehicle{first, second}, system, nil, nil, stations, vertex_set), first, second
+    }
+    railway_at := func(incident int, v int) repair_order {
+        return repair_order{incident: incident, repair_type: RAILWAY_REPAIR, vertex1: v, vertex2: 1}
+    }
+    platform_at := func(incident int, v int) repair_order {
+        return repair_order{incident: incident, repair_type: PLATFORM_REPAIR, index: v}
+    }
+    check := func(policy string, vehicle *repair_vehicle, want ...int) {
+        t.Helper()
+        if got := assigned(vehicle); fmt.Sprint(got) != fmt.Sprint(want) {
+            t.Errorf("%s: %s got incidents %v, want %v", policy, vehicle.name, got, want)
+        }
+    }
+
+    //nearest idle vehicle first, then the other one, then the queue
+    d, first, second := network(DISPATCH_NEAREST)
+    d.dispatch(railway_at(1, 2))
+    d.dispatch(railway_at(2, 2))
+    d.dispatch(railway_at(3, 2))
+    check(DISPATCH_NEAREST, second, 1)
+    check(DISPATCH_NEAREST, first, 2)
+    if len(d.pending) != 1 {
+        t.Errorf("%s: %d orders queued, want 1", DISPATCH_NEAREST, len(d.pending))
+    }
+
+    //turns, wherever the incident is
+    d, first, second = network(DISPATCH_ROUND_ROBIN)
+    for incident := 1; incident <= 3; incident++ {
+        d.dispatch(railway_at(incident, 2))
+    }
+    check(DISPATCH_ROUND_ROBIN, first, 1, 3)
+    check(DISPATCH_ROUND_ROBIN, second, 2)
+
+    //earliest arrival: second is there at once, then busy for 10h,
+    //first arrives in 1h and is busy until 12h, second can be back at vertex 0 at 11h
+    d, first, second = network(DISPATCH_ETA)
+    d.dispatch(railway_at(1, 2))
+    d.dispatch(railway_at(2, 2))
+    d.dispatch(railway_at(3, 0))
+    check(DISPATCH_ETA, second, 1, 3)
+    check(DISPATCH_ETA, first, 2)
+
+    //queue is served in order by nearest and by fault type by priority
+    for _, policy := range []string{DISPATCH_NEAREST, DISPATCH_PRIORITY} {
+        d, first, second = network(policy)
+        d.dispatch(railway_at(1, 0))
+        d.dispatch(railway_at(2, 2))
+        d.dispatch(platform_at(3, 1))
+        d.dispatch(railway_at(4, 1))
+        first.orders.items = nil
+        d.idle(first)
+        want := 3
+        if policy == DISPATCH_PRIORITY {
+            want = 4
+        }
+        check(policy, first, want)
+        check(policy, second, 2)
+    }
+}
+
+//console open gives back the platform its close took, not one of a train
+//which happened to run just before the console
+func TestConsoleCloseOpenKeepsTrainPlatform(t *testing.T) {
+    use_globals(t)
+    ctx := context.Background()
+    data := input_data{
+        stations: []station{{name: "Central", free_platforms: new_sim_semaphore(2), platforms: 2}},
+        vertex_set: []vertex{{vertex_type: STATION, index: 0}},
+    }
+    st := &data.stations[0]
+    c := &console{ctx: ctx, data: data, out: io.Discard}
+
+    c.execute("close Central")
+    train := scheduler.spawn("Intercity", func() {
+        if st.free_platforms.acquire(ctx) == nil {
+            scheduler.sleep(ctx, 10 * time.Hour)
+        }
+    })
+    scheduler.run(ctx, time.Hour)
+    if scheduler.current != train || len(st.console_closed) != 1 {
+        t.Fatalf("train should run last and console should keep 1 platform, %d kept", len(st.console_closed))
+    }
+    closer := st.console_closed[0]
+
+    c.execute("open Central")
+    if !st.free_platforms.held_by(train) {
+        t.Errorf("open took platform of the train")
+    }
+    if st.free_platforms.held_by(closer) {
+        t.Errorf("open left platform with the console")
+    }
+    if st.free_platforms.free != 1 || st.closed_platforms != 0 || len(st.console_closed) != 0 {
+        t.Errorf("%d platforms free, %d closed, %d by console, want 1, 0, 0", st.free_platforms.free, st.closed_platforms, len(st.console_closed))
+    }
+}
+
+//delay is put down to the waits which made it grow, the rest to running,
+//and made up delay shrinks every cause alike
+func TestDelayLedgerAttribution(t *testing.T) {
+    var l delay_ledger
+    check := func(stop string, got map[string]time.Duration, want map[string]time.Duration) {
+        t.Helper()
+        if fmt.Sprint(got) != fmt.Sprint(want) {
+            t.Errorf("%s: causes %v, want %v", stop, got, want)
+        }
+    }
+
+    //grown by 10m, 6m of it waiting
+    l.wait(CAUSE_PLATFORM, 4 * time.Minute)
+    l.wait(CAUSE_SWITCH, 2 * time.Minute)
+    l.wait(CAUSE_HELD, 0)
+    check("first stop", l.measure(10 * time.Minute), map[string]time.Duration{
+        CAUSE_PLATFORM: 4 * time.Minute, CAUSE_SWITCH: 2 * time.Minute, CAUSE_RUNNING: 4 * time.Minute})
+
+    //grown by 6m after 12m of waiting, half of the wait was made up on the way
+    l.wait(CAUSE_RAILWAY, 12 * time.Minute)
+    check("second stop", l.measure(16 * time.Minute), map[string]time.Duration{
+        CAUSE_PLATFORM: 4 * time.Minute, CAUSE_SWITCH: 2 * time.Minute, CAUSE_RUNNING: 4 * time.Minute, CAUSE_RAILWAY: 6 * time.Minute})
+
+    //half of the delay made up
+    check("third stop", l.measure(8 * time.Minute), map[string]time.Duration{
+        CAUSE_PLATFORM: 2 * time.Minute, CAUSE_SWITCH: time.Minute, CAUSE_RUNNING: 2 * time.Minute, CAUSE_RAILWAY: 3 * time.Minute})
+
+    //early is on time, nothing left to blame
+    check("fourth stop", l.measure(-5 * time.Minute), map[string]time.Duration{})
+    l.wait(CAUSE_CRASH, 3 * time.Minute)
+    check("fifth stop", l.measure(3 * time.Minute), map[string]time.Duration{CAUSE_CRASH: 3 * time.Minute})
+}